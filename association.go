@@ -0,0 +1,568 @@
+package hood
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// associationTags are the sql tags declaring associations. Association fields
+// are not columns, see addFields.
+var associationTags = []string{"has_many", "belongs_to", "many_to_many"}
+
+func isAssociation(sqlTags map[string]string) bool {
+	for _, tag := range associationTags {
+		if _, ok := sqlTags[tag]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// preload loads the associations with the specified field names into out,
+// which is a pointer to a struct or a struct slice, with one query each.
+func (q *Query) preload(out interface{}, names []string) error {
+	v := reflect.ValueOf(out).Elem()
+	rows := []reflect.Value{}
+	if v.Kind() == reflect.Slice {
+		for i := 0; i < v.Len(); i++ {
+			rows = append(rows, reflect.Indirect(v.Index(i)))
+		}
+	} else {
+		rows = append(rows, v)
+	}
+	t := v.Type()
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for _, name := range names {
+		f, ok := t.FieldByName(name)
+		if !ok {
+			return fmt.Errorf("%v has no association %v", t, name)
+		}
+		tags := parseTags(f.Tag.Get("sql"))
+		var err error
+		if column, ok := tags["has_many"]; ok {
+			err = q.preloadHasMany(rows, f, column)
+		} else if column, ok := tags["belongs_to"]; ok {
+			err = q.preloadBelongsTo(rows, f, column)
+		} else if _, ok := tags["many_to_many"]; ok {
+			err = q.preloadManyToMany(rows, t, f)
+		} else {
+			err = fmt.Errorf("field %v of %v is not an association", name, t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// preloadHasMany sets the slice field f of rows to the rows of the associated
+// table whose column matches their primary key.
+func (q *Query) preloadHasMany(rows []reflect.Value, f reflect.StructField, column string) error {
+	if f.Type.Kind() != reflect.Slice {
+		return fmt.Errorf("has_many field %v has to be a slice", f.Name)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	fk := snakeToUpperCamel(column)
+	targetType := f.Type.Elem()
+	if targetType.Kind() == reflect.Ptr {
+		targetType = targetType.Elem()
+	}
+	if _, ok := targetType.FieldByName(fk); !ok {
+		return fmt.Errorf("%v has no field %v for has_many", targetType, fk)
+	}
+	pk, err := singlePkField(rows[0].Type())
+	if err != nil {
+		return err
+	}
+	keys := associationKeys(rows, pk)
+	targets, err := q.findAssociated(f.Type.Elem(), column, keys)
+	if err != nil {
+		return err
+	}
+	byKey := map[interface{}]reflect.Value{}
+	for _, target := range targets {
+		k := associationKey(target.Elem().FieldByName(fk).Interface())
+		s, ok := byKey[k]
+		if !ok {
+			s = reflect.MakeSlice(f.Type, 0, 1)
+		}
+		byKey[k] = reflect.Append(s, associationValue(target, f.Type.Elem()))
+	}
+	for _, row := range rows {
+		s, ok := byKey[associationKey(row.FieldByName(pk).Interface())]
+		if !ok {
+			s = reflect.MakeSlice(f.Type, 0, 0)
+		}
+		row.FieldByIndex(f.Index).Set(s)
+	}
+	return nil
+}
+
+// preloadBelongsTo sets the struct field f of rows to the row of the
+// associated table whose primary key matches their column.
+func (q *Query) preloadBelongsTo(rows []reflect.Value, f reflect.StructField, column string) error {
+	fk := snakeToUpperCamel(column)
+	if len(rows) == 0 {
+		return nil
+	}
+	if _, ok := rows[0].Type().FieldByName(fk); !ok {
+		return fmt.Errorf("%v has no field %v for belongs_to", rows[0].Type(), fk)
+	}
+	targetType := f.Type
+	if targetType.Kind() == reflect.Ptr {
+		targetType = targetType.Elem()
+	}
+	pk, err := singlePkField(targetType)
+	if err != nil {
+		return err
+	}
+	keys := associationKeys(rows, fk)
+	targets, err := q.findAssociated(f.Type, toSnake(pk), keys)
+	if err != nil {
+		return err
+	}
+	byKey := map[interface{}]reflect.Value{}
+	for _, target := range targets {
+		byKey[associationKey(target.Elem().FieldByName(pk).Interface())] = target
+	}
+	for _, row := range rows {
+		if target, ok := byKey[associationKey(row.FieldByName(fk).Interface())]; ok {
+			row.FieldByIndex(f.Index).Set(associationValue(target, f.Type))
+		}
+	}
+	return nil
+}
+
+// findAssociated finds the rows of type t, or the type t points to, whose
+// column matches one of keys. The rows are returned as pointers, ordered by
+// their primary key if they have one. Each query matches at most as many keys
+// as the dialect accepts parameters.
+func (q *Query) findAssociated(t reflect.Type, column string, keys []interface{}) ([]reflect.Value, error) {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	targets := []reflect.Value{}
+	for _, chunk := range q.associationChunks(keys) {
+		out := reflect.New(reflect.SliceOf(t))
+		query := q.hood.Where(Path(column), "IN", chunk)
+		if pk, err := singlePkField(t); err == nil {
+			query = query.OrderBy(Path(toSnake(pk)))
+		}
+		err := query.Find(out.Interface())
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < out.Elem().Len(); i++ {
+			targets = append(targets, out.Elem().Index(i).Addr())
+		}
+	}
+	return targets, nil
+}
+
+// associationChunks splits keys into chunks that fit into the parameter limit
+// of the dialect.
+func (q *Query) associationChunks(keys []interface{}) [][]interface{} {
+	size := q.hood.Dialect.MaxParams()
+	chunks := [][]interface{}{}
+	for len(keys) > size {
+		chunks = append(chunks, keys[:size])
+		keys = keys[size:]
+	}
+	if len(keys) > 0 {
+		chunks = append(chunks, keys)
+	}
+	return chunks
+}
+
+// singlePkField returns the name of the primary key field of the struct type
+// t, which must not be a composite key.
+func singlePkField(t reflect.Type) (string, error) {
+	model, err := singlePkModel(reflect.New(t).Interface())
+	if err != nil {
+		return "", err
+	}
+	return snakeToUpperCamel(model.Pk.Name), nil
+}
+
+// singlePkModel returns the model of f, which must have a primary key that is
+// not a composite key.
+func singlePkModel(f interface{}) (*Model, error) {
+	model, err := interfaceToModel(f)
+	if err != nil {
+		return nil, err
+	}
+	if model.Pk == nil {
+		return nil, ErrNoPrimaryKey
+	}
+	if model.CompositePk() {
+		return nil, errors.New("associations with composite primary keys are not supported")
+	}
+	return model, nil
+}
+
+// associationKeys returns the distinct keys of the field with the specified
+// name in rows, skipping NULL.
+func associationKeys(rows []reflect.Value, name string) []interface{} {
+	seen := map[interface{}]bool{}
+	keys := []interface{}{}
+	for _, row := range rows {
+		k := associationKey(row.FieldByName(name).Interface())
+		if k != nil && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// associationKey normalizes the key v, so that keys of different types, e.g.
+// an Id primary key and an int64 column, match. NULL keys are returned as nil.
+func associationKey(v interface{}) interface{} {
+	if valuer, ok := v.(driver.Valuer); ok {
+		x, err := valuer.Value()
+		if err != nil {
+			return nil
+		}
+		v = x
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return nil
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil
+		}
+		return associationKey(rv.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint())
+	case reflect.String:
+		return rv.String()
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes())
+		}
+	}
+	return v
+}
+
+// associationValue returns the pointer target as a value of type t, which is
+// either the struct type or a pointer to it.
+func associationValue(target reflect.Value, t reflect.Type) reflect.Value {
+	if t.Kind() == reflect.Ptr {
+		return target
+	}
+	return target.Elem()
+}
+
+// joinTable describes the join table of a many_to_many association. The join
+// table has a column for the primary keys of both tables, named after the
+// table, e.g. user_id and role_id, which form its primary key.
+type joinTable struct {
+	table        string
+	ownerColumn  string
+	targetColumn string
+	owner        *Model
+	target       *Model
+	field        reflect.StructField
+}
+
+// manyToManyOf returns the join table of the many_to_many field f of the
+// struct type t.
+func manyToManyOf(t reflect.Type, f reflect.StructField) (*joinTable, error) {
+	elem := f.Type
+	if elem.Kind() == reflect.Slice {
+		elem = elem.Elem()
+	}
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if f.Type.Kind() != reflect.Slice || elem.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("many_to_many field %v has to be a struct slice", f.Name)
+	}
+	owner, err := singlePkModel(reflect.New(t).Interface())
+	if err != nil {
+		return nil, err
+	}
+	target, err := singlePkModel(reflect.New(elem).Interface())
+	if err != nil {
+		return nil, err
+	}
+	if owner.Table == target.Table {
+		return nil, fmt.Errorf("many_to_many field %v associates %v with itself", f.Name, owner.Table)
+	}
+	return &joinTable{
+		table:        parseTags(f.Tag.Get("sql"))["many_to_many"],
+		ownerColumn:  owner.Table + "_" + owner.Pk.Name,
+		targetColumn: target.Table + "_" + target.Pk.Name,
+		owner:        owner,
+		target:       target,
+		field:        f,
+	}, nil
+}
+
+// manyToManyFields returns the join tables of all many_to_many fields of the
+// struct type t.
+func manyToManyFields(t reflect.Type) ([]*joinTable, error) {
+	joins := []*joinTable{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if _, ok := parseTags(f.Tag.Get("sql"))["many_to_many"]; !ok {
+			continue
+		}
+		j, err := manyToManyOf(t, f)
+		if err != nil {
+			return nil, err
+		}
+		joins = append(joins, j)
+	}
+	return joins, nil
+}
+
+// manyToManyBetween returns the join table of the first many_to_many field of
+// owner associating it with target.
+func manyToManyBetween(owner, target interface{}) (*joinTable, error) {
+	ownerType := reflect.Indirect(reflect.ValueOf(owner)).Type()
+	targetType := reflect.Indirect(reflect.ValueOf(target)).Type()
+	joins, err := manyToManyFields(ownerType)
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range joins {
+		if j.targetType() == targetType {
+			return j, nil
+		}
+	}
+	return nil, fmt.Errorf("%v has no many_to_many association with %v", ownerType, targetType)
+}
+
+func (j *joinTable) targetType() reflect.Type {
+	t := j.field.Type.Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// model returns the model of the join table, holding the primary keys of
+// owner and target. Pass nil to get the zero values declaring the columns.
+func (j *joinTable) model(owner, target *Model) *Model {
+	ownerValue := reflect.Zero(reflect.TypeOf(j.owner.Pk.Value)).Interface()
+	targetValue := reflect.Zero(reflect.TypeOf(j.target.Pk.Value)).Interface()
+	if owner != nil && target != nil {
+		ownerValue, targetValue = owner.Pk.Value, target.Pk.Value
+	}
+	newField := func(name string, value interface{}) *ModelField {
+		// join table keys are not auto-incrementing
+		if id, ok := value.(Id); ok {
+			value = int64(id)
+		}
+		return &ModelField{
+			Name:         name,
+			Value:        value,
+			SqlTags:      map[string]string{"pk": ""},
+			ValidateTags: map[string]string{},
+			RawTag:       `sql:"pk"`,
+		}
+	}
+	m := &Model{
+		Table: j.table,
+		Fields: []*ModelField{
+			newField(j.ownerColumn, ownerValue),
+			newField(j.targetColumn, targetValue),
+		},
+		Indexes: Indexes{},
+	}
+	m.Pk = m.Fields[0]
+	m.Pks = m.Fields
+	return m
+}
+
+// Associate adds rows to the join table of the many_to_many field of owner
+// associating it with the type of targets, e.g.
+//
+//   hd.Associate(&user, &admin, &editor)
+//
+// All rows have to be saved before. Adding an existing association fails with
+// the unique violation of the join table primary key.
+func (hood *Hood) Associate(owner interface{}, targets ...interface{}) error {
+	return hood.eachAssociation(owner, targets, func(tx *Hood, j *joinTable, o, t *Model) error {
+		_, err := tx.Dialect.Insert(tx, j.model(o, t))
+		return err
+	})
+}
+
+// Dissociate removes the rows associating owner with targets from the join
+// table, see Associate.
+func (hood *Hood) Dissociate(owner interface{}, targets ...interface{}) error {
+	return hood.eachAssociation(owner, targets, func(tx *Hood, j *joinTable, o, t *Model) error {
+		return tx.Where(Path(j.ownerColumn), "=", o.Pk.Value).
+			And(Path(j.targetColumn), "=", t.Pk.Value).
+			DeleteFrom(j.table)
+	})
+}
+
+// ReplaceAssociations replaces all rows associating owner with the type of
+// targets, which is a slice of structs or struct pointers, or a pointer to one,
+// in a transaction.
+func (hood *Hood) ReplaceAssociations(owner interface{}, targets interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(targets))
+	if v.Kind() != reflect.Slice {
+		return errors.New("targets have to be a slice")
+	}
+	elemType := v.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	elems := make([]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		elem := reflect.Indirect(v.Index(i))
+		if !elem.IsValid() {
+			return errors.New("targets must not contain nil")
+		}
+		elems = append(elems, elem.Addr().Interface())
+	}
+	j, err := manyToManyBetween(owner, reflect.New(elemType).Interface())
+	if err != nil {
+		return err
+	}
+	o, err := associatedModel(owner)
+	if err != nil {
+		return err
+	}
+	return hood.Transaction(func(tx *Hood) error {
+		err := tx.Where(Path(j.ownerColumn), "=", o.Pk.Value).DeleteFrom(j.table)
+		if err != nil {
+			return err
+		}
+		return tx.Associate(owner, elems...)
+	})
+}
+
+// eachAssociation calls f in a transaction for the join table and models of
+// owner and each of targets.
+func (hood *Hood) eachAssociation(owner interface{}, targets []interface{}, f func(tx *Hood, j *joinTable, o, t *Model) error) error {
+	if len(targets) == 0 {
+		return nil
+	}
+	j, err := manyToManyBetween(owner, targets[0])
+	if err != nil {
+		return err
+	}
+	o, err := associatedModel(owner)
+	if err != nil {
+		return err
+	}
+	models := make([]*Model, 0, len(targets))
+	for _, target := range targets {
+		t, err := associatedModel(target)
+		if err != nil {
+			return err
+		}
+		if t.Table != j.target.Table {
+			return fmt.Errorf("can't associate %v and %v in one call", j.target.Table, t.Table)
+		}
+		models = append(models, t)
+	}
+	return hood.Transaction(func(tx *Hood) error {
+		for _, t := range models {
+			err := f(tx, j, o, t)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// associatedModel returns the model of f, which has to be saved.
+func associatedModel(f interface{}) (*Model, error) {
+	model, err := singlePkModel(f)
+	if err != nil {
+		return nil, err
+	}
+	if reflect.ValueOf(model.Pk.Value).IsZero() {
+		return nil, ErrPrimaryKeyNotSet
+	}
+	return model, nil
+}
+
+// preloadManyToMany sets the slice field f of rows of type t to the rows
+// associated through the join table, which are loaded with a JOIN query per
+// chunk of keys.
+func (q *Query) preloadManyToMany(rows []reflect.Value, t reflect.Type, f reflect.StructField) error {
+	j, err := manyToManyOf(t, f)
+	if err != nil {
+		return err
+	}
+	pk := snakeToUpperCamel(j.owner.Pk.Name)
+	byKey := map[interface{}]reflect.Value{}
+	for _, chunk := range q.associationChunks(associationKeys(rows, pk)) {
+		err := q.findManyToMany(j, f.Type, chunk, byKey)
+		if err != nil {
+			return err
+		}
+	}
+	for _, row := range rows {
+		s, ok := byKey[associationKey(row.FieldByName(pk).Interface())]
+		if !ok {
+			s = reflect.MakeSlice(f.Type, 0, 0)
+		}
+		row.FieldByIndex(f.Index).Set(s)
+	}
+	return nil
+}
+
+// findManyToMany adds the rows associated with the owner keys through the join
+// table j to byKey, as slices of type sliceType.
+func (q *Query) findManyToMany(j *joinTable, sliceType reflect.Type, keys []interface{}, byKey map[interface{}]reflect.Value) error {
+	paths := []Path{}
+	for _, field := range j.target.Fields {
+		paths = append(paths, Path(j.target.Table+"."+field.Name))
+	}
+	paths = append(paths, Path(j.table+"."+j.ownerColumn))
+	targetPk := Path(j.target.Table + "." + j.target.Pk.Name)
+	query, args := q.hood.Dialect.QuerySql(q.hood.Select(j.target.Table, paths...).
+		Join(InnerJoin, j.table, Path(j.table+"."+j.targetColumn), targetPk).
+		Where(Path(j.table+"."+j.ownerColumn), "IN", keys).
+		OrderBy(targetPk))
+	it, err := q.hood.IterateSql(query, args...)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	elemType := sliceType.Elem()
+	keyType := reflect.TypeOf(j.model(nil, nil).Pk.Value)
+	for it.Next() {
+		// the last column is the owner key, the others are the target's
+		n := len(it.cols) - 1
+		target := reflect.New(j.targetType())
+		err := q.hood.setRowValue(target.Elem(), it.cols[:n], it.values[:n])
+		if err != nil {
+			return err
+		}
+		key := reflect.New(keyType).Elem()
+		err = q.hood.setRowValue(key, it.cols[n:], it.values[n:])
+		if err != nil {
+			return err
+		}
+		k := associationKey(key.Interface())
+		s, ok := byKey[k]
+		if !ok {
+			s = reflect.MakeSlice(sliceType, 0, 1)
+		}
+		byKey[k] = reflect.Append(s, associationValue(target, elemType))
+	}
+	return it.Err()
+}
@@ -59,14 +59,16 @@ func (d *base) SetModelValue(driverValue, fieldValue reflect.Value) error {
 			if time, ok := driverValue.Elem().Interface().(time.Time); ok {
 				fieldValue.Set(reflect.ValueOf(Updated{time}))
 			} else {
-				panic(fmt.Sprintf("cannot set updated value %T", driverValue.Elem().Interface()))
+				return fmt.Errorf("cannot set updated value %T", driverValue.Elem().Interface())
 			}
 		} else if fieldType == reflect.TypeOf(Created{}) {
 			if time, ok := driverValue.Elem().Interface().(time.Time); ok {
 				fieldValue.Set(reflect.ValueOf(Created{time}))
 			} else {
-				panic(fmt.Sprintf("cannot set created value %T", driverValue.Elem().Interface()))
+				return fmt.Errorf("cannot set created value %T", driverValue.Elem().Interface())
 			}
+		} else {
+			return fmt.Errorf("cannot set value of type %v, it has to implement sql.Scanner", fieldType)
 		}
 	}
 	return nil
@@ -82,52 +84,119 @@ func (d *base) ConvertHoodType(f interface{}) interface{} {
 	return f
 }
 
-func (d *base) appendWhere(query *[]string, args *[]interface{}, hood *Hood) {
-	if x := hood.where; len(x) > 0 {
-		for _, v := range x {
-			// TODO: could be prettier!
-			var c *clause
-			switch p := v.(type) {
-			case *whereClause:
-				*query = append(*query, "WHERE")
-				c = (*clause)(p)
-			case *andClause:
-				*query = append(*query, "AND")
-				c = (*clause)(p)
-			case *orClause:
-				*query = append(*query, "OR")
-				c = (*clause)(p)
-			}
-			if c != nil {
-				*query = append(*query, c.a.Quote(d.Dialect), c.op)
-				if path, ok := c.b.(Path); ok {
-					*query = append(*query, path.Quote(d.Dialect))
-				} else {
-					*query = append(*query, "?")
-					*args = append(*args, c.b)
-				}
+func (d *base) appendWhere(query *[]string, args *[]interface{}, q *Query) {
+	d.appendConditions(query, args, q.where, "WHERE")
+}
+
+// appendConditions appends the where clauses and groups in where. The leading
+// where clause is prefixed with whereKeyword, which is empty inside groups.
+func (d *base) appendConditions(query *[]string, args *[]interface{}, where []interface{}, whereKeyword string) {
+	for _, v := range where {
+		var (
+			keyword string
+			c       *clause
+			g       *group
+		)
+		switch p := v.(type) {
+		case *whereClause:
+			keyword, c = whereKeyword, (*clause)(p)
+		case *andClause:
+			keyword, c = "AND", (*clause)(p)
+		case *orClause:
+			keyword, c = "OR", (*clause)(p)
+		case *whereGroup:
+			keyword, g = whereKeyword, (*group)(p)
+		case *andGroup:
+			keyword, g = "AND", (*group)(p)
+		case *orGroup:
+			keyword, g = "OR", (*group)(p)
+		default:
+			panic(fmt.Sprintf("invalid where clause %T", v))
+		}
+		if g != nil && len(g.where) == 0 {
+			continue
+		}
+		if keyword != "" {
+			*query = append(*query, keyword)
+		}
+		if g != nil {
+			inner := []string{}
+			d.appendConditions(&inner, args, g.where, "")
+			*query = append(*query, "("+strings.Join(inner, " ")+")")
+			continue
+		}
+		d.appendClause(query, args, c)
+	}
+}
+
+func (d *base) appendClause(query *[]string, args *[]interface{}, c *clause) {
+	switch c.op {
+	case "IS NULL", "IS NOT NULL":
+		*query = append(*query, c.a.Quote(d.Dialect), c.op)
+	case "IN", "NOT IN":
+		list, _ := c.list()
+		if list.Len() == 0 {
+			// nothing is IN an empty list, everything is NOT IN it
+			if c.op == "IN" {
+				*query = append(*query, "1 = 0")
 			} else {
-				panic(fmt.Sprintf("invalid where clause %T", v))
+				*query = append(*query, "1 = 1")
 			}
+			return
+		}
+		markers := make([]string, 0, list.Len())
+		for i := 0; i < list.Len(); i++ {
+			markers = append(markers, "?")
+			*args = append(*args, list.Index(i).Interface())
+		}
+		*query = append(*query, c.a.Quote(d.Dialect), c.op, "("+strings.Join(markers, ", ")+")")
+	case "BETWEEN", "NOT BETWEEN":
+		list, _ := c.list()
+		*query = append(*query, c.a.Quote(d.Dialect), c.op, "? AND ?")
+		*args = append(*args, list.Index(0).Interface(), list.Index(1).Interface())
+	default:
+		*query = append(*query, c.a.Quote(d.Dialect), c.op)
+		if path, ok := c.b.(Path); ok {
+			*query = append(*query, path.Quote(d.Dialect))
+		} else {
+			*query = append(*query, "?")
+			*args = append(*args, c.b)
 		}
 	}
 }
 
-func (d *base) QuerySql(hood *Hood) (string, []interface{}) {
+func (d *base) QuerySql(q *Query) (string, []interface{}) {
+	query, args := d.querySql(q)
+	if x := q.limit; x > 0 {
+		query = append(query, "LIMIT ?")
+		args = append(args, q.limit)
+	}
+	if x := q.offset; x > 0 {
+		query = append(query, "OFFSET ?")
+		args = append(args, q.offset)
+	}
+	return substituteMarkers(d.Dialect, strings.Join(query, " ")), args
+}
+
+// querySql returns the query parts and arguments up to and including the
+// ORDER BY clause. Dialects differ in how they express limits and offsets.
+func (d *base) querySql(q *Query) ([]string, []interface{}) {
 	query := make([]string, 0, 20)
 	args := make([]interface{}, 0, 20)
-	if hood.selectTable != "" {
+	if q.selectTable != "" {
 		selector := "*"
-		if paths := hood.selectPaths; len(paths) > 0 {
+		if x := q.aggregate; x != "" {
+			selector = x
+		} else if paths := q.selectPaths; len(paths) > 0 {
 			quoted := []string{}
 			for _, p := range paths {
 				quoted = append(quoted, p.Quote(d.Dialect))
 			}
 			selector = strings.Join(quoted, ", ")
 		}
-		query = append(query, fmt.Sprintf("SELECT %v FROM %v", selector, d.Dialect.Quote(hood.selectTable)))
+		query = append(query, fmt.Sprintf("SELECT %v FROM %v", selector, d.Dialect.Quote(q.selectTable)))
 	}
-	for _, j := range hood.joins {
+	for _, j := range q.joins {
 		joinType := "INNER"
 		switch j.join {
 		case LeftJoin:
@@ -145,48 +214,43 @@ func (d *base) QuerySql(hood *Hood) (string, []interface{}) {
 			j.b.Quote(d.Dialect),
 		))
 	}
-	d.appendWhere(&query, &args, hood)
-	if x := hood.groupBy; x != "" {
+	d.appendWhere(&query, &args, q)
+	if x := q.groupBy; x != "" {
 		query = append(query, fmt.Sprintf("GROUP BY %v", x.Quote(d.Dialect)))
 	}
-	if x := hood.havingCond; x != "" {
+	if x := q.havingCond; x != "" {
 		query = append(query, fmt.Sprintf("HAVING %v", x))
-		args = append(args, hood.havingArgs...)
+		args = append(args, q.havingArgs...)
 	}
-	if x := hood.orderBy; x != "" {
+	if x := q.orderBy; x != "" {
 		query = append(query, fmt.Sprintf("ORDER BY %v", x.Quote(d.Dialect)))
 
-		if x := hood.order; x != "" {
+		if x := q.order; x != "" {
 			query = append(query, fmt.Sprintf("%v", x))
 		}
 	}
-	if x := hood.limit; x > 0 {
-		query = append(query, "LIMIT ?")
-		args = append(args, hood.limit)
-	}
-	if x := hood.offset; x > 0 {
-		query = append(query, "OFFSET ?")
-		args = append(args, hood.offset)
-	}
-	return hood.substituteMarkers(strings.Join(query, " ")), args
+	return query, args
 }
 
-func (d *base) Insert(hood *Hood, model *Model) (Id, error) {
+func (d *base) Insert(hood *Hood, model *Model) (interface{}, error) {
 	sql, args := d.Dialect.InsertSql(model)
 	result, err := hood.Exec(sql, args...)
 	if err != nil {
-		return -1, err
+		return nil, err
+	}
+	if !generatedPk(d.Dialect, model) {
+		return model.PkValue(), nil
 	}
 	id, err := result.LastInsertId()
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
-	return Id(id), nil
+	return generatedPkValue(model, id), nil
 }
 
 func (d *base) InsertSql(model *Model) (string, []interface{}) {
 	m := 0
-	columns, markers, values := columnsMarkersAndValuesForModel(d.Dialect, model, &m)
+	columns, markers, values := columnsMarkersAndValuesForModel(d.Dialect, model, &m, true)
 	quotedColumns := make([]string, 0, len(columns))
 	for _, c := range columns {
 		quotedColumns = append(quotedColumns, d.Dialect.Quote(c))
@@ -200,88 +264,250 @@ func (d *base) InsertSql(model *Model) (string, []interface{}) {
 	return sql, values
 }
 
-func (d *base) Update(hood *Hood, model *Model) (Id, error) {
+func (d *base) InsertAll(hood *Hood, models []*Model) ([]interface{}, error) {
+	if !models[0].AutoIncrement() {
+		for _, model := range models {
+			if generatedPk(d.Dialect, model) {
+				// zero keys are left out, so rows may have different columns
+				return insertEach(hood, d.Dialect, models)
+			}
+		}
+	}
+	sql, args := d.Dialect.InsertAllSql(models)
+	result, err := hood.Exec(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	if !models[0].AutoIncrement() {
+		return insertedIds(models, 0), nil
+	}
+	// the last insert id is the id of the first inserted row
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return insertedIds(models, id), nil
+}
+
+// insertEach inserts models with one statement each, returning their ids.
+func insertEach(hood *Hood, dialect Dialect, models []*Model) ([]interface{}, error) {
+	ids := make([]interface{}, 0, len(models))
+	for _, model := range models {
+		id, err := dialect.Insert(hood, model)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// insertedIds returns the primary keys of the inserted models. Auto-increment
+// keys are assigned consecutively, starting with firstId.
+func insertedIds(models []*Model, firstId int64) []interface{} {
+	ids := make([]interface{}, 0, len(models))
+	for i, model := range models {
+		if model.AutoIncrement() {
+			ids = append(ids, Id(firstId+int64(i)))
+		} else {
+			ids = append(ids, model.PkValue())
+		}
+	}
+	return ids
+}
+
+// queryInsertedIds runs the insert query returning the row index and the
+// auto-increment id of each of the n inserted rows, in any order.
+func queryInsertedIds(hood *Hood, query string, args []interface{}, n int) ([]interface{}, error) {
+	rows, err := hood.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make([]interface{}, n)
+	found := 0
+	for rows.Next() {
+		var i, id int64
+		err := rows.Scan(&i, &id)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(n) || ids[i] != nil {
+			return nil, fmt.Errorf("got id for unexpected row %d", i)
+		}
+		ids[i] = Id(id)
+		found++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if found != n {
+		return nil, fmt.Errorf("inserted %d rows, but got %d ids", n, found)
+	}
+	return ids, nil
+}
+
+func (d *base) InsertAllSql(models []*Model) (string, []interface{}) {
+	columns, rows, values := d.insertAllValues(models)
+	sql := fmt.Sprintf(
+		"INSERT INTO %v (%v) VALUES %v",
+		d.Dialect.Quote(models[0].Table),
+		strings.Join(columns, ", "),
+		strings.Join(rows, ", "),
+	)
+	return sql, values
+}
+
+// insertAllValues returns the quoted columns, the rows of markers and the
+// values for inserting models.
+func (d *base) insertAllValues(models []*Model) ([]string, []string, []interface{}) {
+	m := 0
+	quotedColumns := []string{}
+	rows := make([]string, 0, len(models))
+	values := []interface{}{}
+	for i, model := range models {
+		columns, markers, v := columnsMarkersAndValuesForModel(d.Dialect, model, &m, true)
+		if i == 0 {
+			for _, c := range columns {
+				quotedColumns = append(quotedColumns, d.Dialect.Quote(c))
+			}
+		}
+		rows = append(rows, "("+strings.Join(markers, ", ")+")")
+		values = append(values, v...)
+	}
+	return quotedColumns, rows, values
+}
+
+func (d *base) MaxInsertRows(columns int) int {
+	return maxInsertRows(d.Dialect.MaxParams(), columns)
+}
+
+// quoteString quotes s as a string literal.
+func (d *base) quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+func (d *base) MaxParams() int {
+	return 65535
+}
+
+// maxInsertRows returns the number of rows with the passed number of columns
+// that fit into maxParams parameters.
+func maxInsertRows(maxParams, columns int) int {
+	if columns < 1 {
+		return maxParams
+	}
+	return maxParams / columns
+}
+
+func (d *base) Update(hood *Hood, model *Model) (interface{}, error) {
 	sql, args := d.Dialect.UpdateSql(model)
 	_, err := hood.Exec(sql, args...)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
-	return model.Pk.Value.(Id), nil
+	return model.PkValue(), nil
 }
 
 func (d *base) UpdateSql(model *Model) (string, []interface{}) {
 	m := 0
-	columns, markers, values := columnsMarkersAndValuesForModel(d.Dialect, model, &m)
+	columns, markers, values := columnsMarkersAndValuesForModel(d.Dialect, model, &m, false)
 	pairs := make([]string, 0, len(columns))
 	for i, column := range columns {
 		pairs = append(pairs, fmt.Sprintf("%v = %v", d.Dialect.Quote(column), markers[i]))
 	}
+	condition, pkValues := d.pkCondition(model, &m)
 	sql := fmt.Sprintf(
-		"UPDATE %v SET %v WHERE %v = %v",
+		"UPDATE %v SET %v WHERE %v",
 		d.Dialect.Quote(model.Table),
 		strings.Join(pairs, ", "),
-		d.Dialect.Quote(model.Pk.Name),
-		d.Dialect.NextMarker(&m),
+		condition,
 	)
-	values = append(values, model.Pk.Value)
-	return sql, values
+	return sql, append(values, pkValues...)
 }
 
-func (d *base) Delete(hood *Hood, model *Model) (Id, error) {
+func (d *base) Delete(hood *Hood, model *Model) (interface{}, error) {
 	sql, args := d.Dialect.DeleteSql(model)
 	_, err := hood.Exec(sql, args...)
-	return args[0].(Id), err
+	return model.PkValue(), err
 }
 
 func (d *base) DeleteSql(model *Model) (string, []interface{}) {
 	n := 0
+	condition, values := d.pkCondition(model, &n)
 	return fmt.Sprintf(
-		"DELETE FROM %v WHERE %v = %v",
+		"DELETE FROM %v WHERE %v",
 		d.Dialect.Quote(model.Table),
-		d.Dialect.Quote(model.Pk.Name),
-		d.Dialect.NextMarker(&n),
-	), []interface{}{model.Pk.Value}
+		condition,
+	), values
+}
+
+// pkCondition returns the condition matching all primary key columns of model
+// and its arguments.
+func (d *base) pkCondition(model *Model, markerPos *int) (string, []interface{}) {
+	pairs := make([]string, 0, len(model.Pks))
+	values := make([]interface{}, 0, len(model.Pks))
+	for _, pk := range model.Pks {
+		pairs = append(pairs, fmt.Sprintf("%v = %v", d.Dialect.Quote(pk.Name), d.Dialect.NextMarker(markerPos)))
+		values = append(values, pk.Value)
+	}
+	return strings.Join(pairs, " AND "), values
 }
 
-func (d *base) DeleteFrom(hood *Hood, table string) error {
-	sql, args := d.Dialect.DeleteFromSql(hood, table)
-	_, err := hood.Exec(sql, args...)
+func (d *base) DeleteFrom(q *Query, table string) error {
+	sql, args, err := d.Dialect.DeleteFromSql(q, table)
+	if err != nil {
+		return err
+	}
+	_, err = q.hood.Exec(sql, args...)
 	return err
 }
 
-func (d *base) DeleteFromSql(hood *Hood, table string) (string, []interface{}) {
-	if len(hood.where) == 0 {
-		panic("no where clause specified")
+func (d *base) DeleteFromSql(q *Query, table string) (string, []interface{}, error) {
+	if len(q.where) == 0 {
+		return "", nil, ErrNoWhereClause
 	}
 	query := []string{
 		fmt.Sprintf("DELETE FROM %s", d.Dialect.Quote(table)),
 	}
 	args := []interface{}{}
-	d.appendWhere(&query, &args, hood)
+	d.appendWhere(&query, &args, q)
 
-	return hood.substituteMarkers(strings.Join(query, " ")), args
+	return substituteMarkers(d.Dialect, strings.Join(query, " ")), args, nil
 }
 
 func (d *base) CreateTable(hood *Hood, model *Model) error {
-	_, err := hood.Exec(d.Dialect.CreateTableSql(model, false))
+	sql, err := d.Dialect.CreateTableSql(model, false)
+	if err != nil {
+		return err
+	}
+	_, err = hood.Exec(sql)
 	return err
 }
 
 func (d *base) CreateTableIfNotExists(hood *Hood, model *Model) error {
-	_, err := hood.Exec(d.Dialect.CreateTableSql(model, true))
+	sql, err := d.Dialect.CreateTableSql(model, true)
+	if err != nil {
+		return err
+	}
+	_, err = hood.Exec(sql)
 	return err
 }
 
-func (d *base) CreateTableSql(model *Model, ifNotExists bool) string {
+func (d *base) CreateTableSql(model *Model, ifNotExists bool) (string, error) {
 	a := []string{"CREATE TABLE "}
 	if ifNotExists {
 		a = append(a, "IF NOT EXISTS ")
 	}
 	a = append(a, d.Dialect.Quote(model.Table), " ( ")
 	for i, field := range model.Fields {
+		typ, err := d.Dialect.SqlType(field.sqlValue(), field.Size())
+		if err != nil {
+			return "", err
+		}
 		b := []string{
 			d.Dialect.Quote(field.Name),
-			d.Dialect.SqlType(field.Value, field.Size()),
+			typ,
 		}
 		if field.NotNull() {
 			b = append(b, d.Dialect.KeywordNotNull())
@@ -289,10 +515,10 @@ func (d *base) CreateTableSql(model *Model, ifNotExists bool) string {
 		if x := field.Default(); x != "" {
 			b = append(b, d.Dialect.KeywordDefault(x))
 		}
-		if field.PrimaryKey() {
+		if field.PrimaryKey() && !model.CompositePk() {
 			b = append(b, d.Dialect.KeywordPrimaryKey())
 		}
-		if incKeyword := d.Dialect.KeywordAutoIncrement(); field.PrimaryKey() && incKeyword != "" {
+		if incKeyword := d.Dialect.KeywordAutoIncrement(); autoIncrementColumn(d.Dialect, model, field) && incKeyword != "" {
 			b = append(b, incKeyword)
 		}
 		a = append(a, strings.Join(b, " "))
@@ -300,8 +526,63 @@ func (d *base) CreateTableSql(model *Model, ifNotExists bool) string {
 			a = append(a, ", ")
 		}
 	}
+	if model.CompositePk() {
+		quoted := make([]string, 0, len(model.Pks))
+		for _, pk := range model.Pks {
+			quoted = append(quoted, d.Dialect.Quote(pk.Name))
+		}
+		a = append(a, fmt.Sprintf(", %v (%v)", d.Dialect.KeywordPrimaryKey(), strings.Join(quoted, ", ")))
+	}
+	for _, fk := range model.ForeignKeys() {
+		a = append(a, ", "+d.Dialect.ForeignKeySql(fk))
+	}
 	a = append(a, " )")
-	return strings.Join(a, "")
+	return strings.Join(a, ""), nil
+}
+
+// integerPkAutoIncrementer is implemented by dialects that declare integer
+// fields tagged pk, which are the only primary key, as auto-incrementing, like
+// all primary keys were before Id marked auto-incrementing keys.
+type integerPkAutoIncrementer interface {
+	autoIncrementIntegerPk() bool
+}
+
+// autoIncrementColumn tests if field is declared as an auto-incrementing
+// column by dialect.
+func autoIncrementColumn(dialect Dialect, model *Model, field *ModelField) bool {
+	if field.AutoIncrement() {
+		return true
+	}
+	if x, ok := dialect.(integerPkAutoIncrementer); !ok || !x.autoIncrementIntegerPk() {
+		return false
+	}
+	if !field.PrimaryKey() || model.CompositePk() {
+		return false
+	}
+	switch reflect.ValueOf(field.Value).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// generatedColumn tests if the database generates the value of field on
+// insert, which are Id fields and zero auto-incrementing columns.
+func generatedColumn(dialect Dialect, model *Model, field *ModelField) bool {
+	return autoIncrementColumn(dialect, model, field) && (field.AutoIncrement() || field.Zero())
+}
+
+// generatedPk tests if the database generates the primary key of model on
+// insert.
+func generatedPk(dialect Dialect, model *Model) bool {
+	return model.Pk != nil && !model.CompositePk() && generatedColumn(dialect, model, model.Pk)
+}
+
+// generatedPkValue converts the id the database generated for model to the
+// type of its primary key.
+func generatedPkValue(model *Model, id int64) interface{} {
+	return reflect.ValueOf(id).Convert(reflect.TypeOf(model.Pk.Value)).Interface()
 }
 
 func (d *base) DropTable(hood *Hood, table string) error {
@@ -332,18 +613,30 @@ func (d *base) RenameTableSql(from, to string) string {
 	return fmt.Sprintf("ALTER TABLE %v RENAME TO %v", d.Dialect.Quote(from), d.Dialect.Quote(to))
 }
 
-func (d *base) AddColumn(hood *Hood, table, column string, typ interface{}, size int) error {
-	_, err := hood.Exec(d.Dialect.AddColumnSql(table, column, typ, size))
+func (d *base) AddColumn(hood *Hood, table, column string, typ interface{}, size int, fk *ForeignKey) error {
+	sql, err := d.Dialect.AddColumnSql(table, column, typ, size, fk)
+	if err != nil {
+		return err
+	}
+	_, err = hood.Exec(sql)
 	return err
 }
 
-func (d *base) AddColumnSql(table, column string, typ interface{}, size int) string {
-	return fmt.Sprintf(
+func (d *base) AddColumnSql(table, column string, typ interface{}, size int, fk *ForeignKey) (string, error) {
+	sqlType, err := d.Dialect.SqlType(typ, size)
+	if err != nil {
+		return "", err
+	}
+	sql := fmt.Sprintf(
 		"ALTER TABLE %v ADD COLUMN %v %v",
 		d.Dialect.Quote(table),
 		d.Dialect.Quote(column),
-		d.Dialect.SqlType(typ, size),
+		sqlType,
 	)
+	if fk != nil {
+		sql += ", ADD " + d.Dialect.ForeignKeySql(fk)
+	}
+	return sql, nil
 }
 
 func (d *base) RenameColumn(hood *Hood, table, from, to string) error {
@@ -361,17 +654,25 @@ func (d *base) RenameColumnSql(table, from, to string) string {
 }
 
 func (d *base) ChangeColumn(hood *Hood, table, column string, typ interface{}, size int) error {
-	_, err := hood.Exec(d.Dialect.ChangeColumnSql(table, column, typ, size))
+	sql, err := d.Dialect.ChangeColumnSql(table, column, typ, size)
+	if err != nil {
+		return err
+	}
+	_, err = hood.Exec(sql)
 	return err
 }
 
-func (d *base) ChangeColumnSql(table, column string, typ interface{}, size int) string {
+func (d *base) ChangeColumnSql(table, column string, typ interface{}, size int) (string, error) {
+	sqlType, err := d.Dialect.SqlType(typ, size)
+	if err != nil {
+		return "", err
+	}
 	return fmt.Sprintf(
 		"ALTER TABLE %v ALTER COLUMN %v TYPE %v",
 		d.Dialect.Quote(table),
 		d.Dialect.Quote(column),
-		d.Dialect.SqlType(typ, size),
-	)
+		sqlType,
+	), nil
 }
 
 func (d *base) DropColumn(hood *Hood, table, column string) error {
@@ -419,6 +720,68 @@ func (d *base) DropIndexSql(name string) string {
 	return fmt.Sprintf("DROP INDEX %v", d.Dialect.Quote(name))
 }
 
+func (d *base) ForeignKeySql(fk *ForeignKey) string {
+	return fmt.Sprintf(
+		"CONSTRAINT %v FOREIGN KEY (%v) %v",
+		d.Dialect.Quote(fk.Name),
+		d.Dialect.Quote(fk.Column),
+		d.referencesSql(fk),
+	)
+}
+
+// referencesSql returns the REFERENCES clause of fk, including its actions.
+func (d *base) referencesSql(fk *ForeignKey) string {
+	a := []string{"REFERENCES", d.Dialect.Quote(fk.RefTable)}
+	if fk.RefColumn != "" {
+		a = append(a, "("+d.Dialect.Quote(fk.RefColumn)+")")
+	}
+	if x := fk.OnDelete; x != "" {
+		a = append(a, "ON DELETE", strings.ToUpper(x))
+	}
+	if x := fk.OnUpdate; x != "" {
+		a = append(a, "ON UPDATE", strings.ToUpper(x))
+	}
+	return strings.Join(a, " ")
+}
+
+func (d *base) AddForeignKey(hood *Hood, table string, fk *ForeignKey) error {
+	_, err := hood.Exec(d.Dialect.AddForeignKeySql(table, fk))
+	return err
+}
+
+func (d *base) AddForeignKeySql(table string, fk *ForeignKey) string {
+	return fmt.Sprintf("ALTER TABLE %v ADD %v", d.Dialect.Quote(table), d.Dialect.ForeignKeySql(fk))
+}
+
+func (d *base) DropForeignKey(hood *Hood, table, name string) error {
+	_, err := hood.Exec(d.Dialect.DropForeignKeySql(table, name))
+	return err
+}
+
+func (d *base) DropForeignKeySql(table, name string) string {
+	return fmt.Sprintf("ALTER TABLE %v DROP CONSTRAINT %v", d.Dialect.Quote(table), d.Dialect.Quote(name))
+}
+
+func (d *base) SavepointSql(name string) string {
+	return fmt.Sprintf("SAVEPOINT %v", d.Dialect.Quote(name))
+}
+
+func (d *base) ReleaseSavepointSql(name string) string {
+	return fmt.Sprintf("RELEASE SAVEPOINT %v", d.Dialect.Quote(name))
+}
+
+func (d *base) RollbackToSavepointSql(name string) string {
+	return fmt.Sprintf("ROLLBACK TO SAVEPOINT %v", d.Dialect.Quote(name))
+}
+
+func (d *base) IsRetryable(err error) bool {
+	return false
+}
+
+func (d *base) ConvertError(err error) error {
+	return err
+}
+
 func (d *base) KeywordNotNull() string {
 	return "NOT NULL"
 }
@@ -29,6 +29,7 @@ var (
 	command           string
 	workingDir        string
 	testMode          bool
+	serializable      bool
 	migrationTemplate = template.Must(template.New("migration").Parse(_migrationTemplate))
 )
 
@@ -41,6 +42,7 @@ func init() {
 	flag.StringVar(&keyPath, "key-path", "", `Sets the key path of the driver and source fields relative to the environment field in the config.json. For example, if the driver and source fields were located at <environment>:{"postgres":{"hood":{"driver": ... }}} the key path would be "postgres.hood"`)
 	flag.StringVar(&driver, "driver", "", "Sets the driver. If the driver and source fields are set, the config.json will be ignored.")
 	flag.StringVar(&source, "source", "", "Sets the source. If the driver and source fields are set, the config.json will be ignored.")
+	flag.BoolVar(&serializable, "serializable", false, "If set to true, migrations are run in serializable transactions.")
 	flag.BoolVar(&testMode, "test", false, "If set to true, just the configuration is printed without running a command.")
 	flag.Parse()
 
@@ -112,6 +114,7 @@ func main() {
 		fmt.Printf("key-path:\t'%s'\n", keyPath)
 		fmt.Printf("driver:\t\t'%s'\n", driver)
 		fmt.Printf("source:\t\t'%s'\n", source)
+		fmt.Printf("serializable:\t%t\n", serializable)
 		return
 	}
 
@@ -279,6 +282,7 @@ func runMigrations(steps int32) {
 		"-source", strconv.Quote(source),
 		"-schema", strconv.Quote(schemaFile),
 		"-steps", fmt.Sprintf("%d", steps),
+		fmt.Sprintf("-serializable=%t", serializable),
 	)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"flag"
 	"github.com/eaigner/hood"
 	"io/ioutil"
@@ -13,10 +14,11 @@ import (
 )
 
 var (
-	driver     string
-	source     string
-	schemaPath string
-	steps      int
+	driver       string
+	source       string
+	schemaPath   string
+	steps        int
+	serializable bool
 )
 
 func init() {
@@ -24,6 +26,7 @@ func init() {
 	flag.StringVar(&source, "source", "", "Sets the source")
 	flag.StringVar(&schemaPath, "schema", "db/schema.go", "Sets the schema path")
 	flag.IntVar(&steps, "steps", 0, "Sets the steps")
+	flag.BoolVar(&serializable, "serializable", false, "Runs the migrations in serializable transactions")
 	flag.Parse()
 
 	if driver == "" {
@@ -99,7 +102,10 @@ func main() {
 	hd.Log = true
 
 	// Create migration table if necessary
-	tx := hd.Begin()
+	tx, err := begin(hd)
+	if err != nil {
+		panic(err)
+	}
 	tx.CreateTableIfNotExists(&Migrations{})
 	err = tx.Commit()
 	if err != nil {
@@ -175,11 +181,14 @@ func main() {
 
 func apply(stamp, current int, count *int, hd *hood.Hood, info *Migrations, structVal reflect.Value, method reflect.Method) {
 	log.Printf("applying %s...", method.Name)
-	txn := hd.Begin()
+	txn, err := begin(hd)
+	if err != nil {
+		panic(err)
+	}
 	method.Func.Call([]reflect.Value{structVal, reflect.ValueOf(txn)})
 	info.Current = current
 	txn.Save(info)
-	err := txn.Commit()
+	err = txn.Commit()
 	if err != nil {
 		panic(err)
 	} else {
@@ -187,3 +196,10 @@ func apply(stamp, current int, count *int, hd *hood.Hood, info *Migrations, stru
 	}
 
 }
+
+func begin(hd *hood.Hood) (*hood.Hood, error) {
+	if serializable {
+		return hd.BeginWith(hood.TxOptions{Isolation: sql.LevelSerializable})
+	}
+	return hd.Begin()
+}
@@ -15,7 +15,8 @@ type Dialect interface {
 
 	// SqlType returns the SQL type for the provided interface type. The size
 	// parameter delcares the data size for the column (e.g. for VARCHARs).
-	SqlType(f interface{}, size int) string
+	// An *UnsupportedTypeError is returned if the type has no SQL type.
+	SqlType(f interface{}, size int) (string, error)
 
 	// If database do not support boolean type this can be used to parse int
 	// value to boolean value.
@@ -32,32 +33,50 @@ type Dialect interface {
 	ConvertHoodType(f interface{}) interface{}
 
 	// QuerySql returns the resulting query sql and attributes.
-	QuerySql(hood *Hood) (sql string, args []interface{})
+	QuerySql(query *Query) (sql string, args []interface{})
 
-	// Insert inserts the values in model and returns the inserted rows Id.
-	Insert(hood *Hood, model *Model) (Id, error)
+	// Insert inserts the values in model and returns the primary key of the
+	// inserted row.
+	Insert(hood *Hood, model *Model) (interface{}, error)
 
 	// InsertSql returns the sql for inserting the passed model.
 	InsertSql(model *Model) (sql string, args []interface{})
 
+	// InsertAll inserts the values in models, which are rows of the same
+	// table, with a single statement and returns their primary keys.
+	InsertAll(hood *Hood, models []*Model) ([]interface{}, error)
+
+	// InsertAllSql returns the sql for inserting the passed models with a
+	// single statement.
+	InsertAllSql(models []*Model) (sql string, args []interface{})
+
+	// MaxInsertRows returns the maximum number of rows a single InsertAll
+	// statement can insert, with the passed number of columns per row.
+	MaxInsertRows(columns int) int
+
+	// MaxParams returns the maximum number of parameters a single statement
+	// can have.
+	MaxParams() int
+
 	// Update updates the values in the specified model and returns the
-	// updated rows Id.
-	Update(hood *Hood, model *Model) (Id, error)
+	// primary key of the updated row.
+	Update(hood *Hood, model *Model) (interface{}, error)
 
 	// UpdateSql returns the sql for updating the specified model.
 	UpdateSql(model *Model) (string, []interface{})
 
-	// Delete drops the row matching the primary key of model and returns the affected Id.
-	Delete(hood *Hood, model *Model) (Id, error)
+	// Delete drops the row matching the primary key of model and returns the affected primary key.
+	Delete(hood *Hood, model *Model) (interface{}, error)
 
 	// DeleteSql returns the sql for deleting the row matching model's primary key.
 	DeleteSql(model *Model) (string, []interface{})
 
 	// DeleteFrom deletes the matching rows in the specified table
-	DeleteFrom(hood *Hood, table string) error
+	DeleteFrom(query *Query, table string) error
 
-	// DeleteFromSql returns the sql for DeleteFrom
-	DeleteFromSql(hood *Hood, table string) (string, []interface{})
+	// DeleteFromSql returns the sql for DeleteFrom, or ErrNoWhereClause if
+	// the query has no WHERE clause.
+	DeleteFromSql(query *Query, table string) (string, []interface{}, error)
 
 	// CreateTable creates the table specified in model.
 	CreateTable(hood *Hood, model *Model) error
@@ -66,7 +85,7 @@ type Dialect interface {
 	CreateTableIfNotExists(hood *Hood, model *Model) error
 
 	// CreateTableSql returns the sql for creating a table.
-	CreateTableSql(model *Model, ifNotExists bool) string
+	CreateTableSql(model *Model, ifNotExists bool) (string, error)
 
 	// DropTable drops the specified table.
 	DropTable(hood *Hood, table string) error
@@ -83,11 +102,12 @@ type Dialect interface {
 	// RenameTableSql returns the sql for renaming the specified table.
 	RenameTableSql(from, to string) string
 
-	// AddColumn adds the columns to the corresponding table.
-	AddColumn(hood *Hood, table, column string, typ interface{}, size int) error
+	// AddColumn adds the columns to the corresponding table. fk is the
+	// foreign key constraint declared on the column, or nil.
+	AddColumn(hood *Hood, table, column string, typ interface{}, size int, fk *ForeignKey) error
 
 	// AddColumnSql returns the sql for adding the specified column in table.
-	AddColumnSql(table, column string, typ interface{}, size int) string
+	AddColumnSql(table, column string, typ interface{}, size int, fk *ForeignKey) (string, error)
 
 	// RenameColumn renames a table column in the specified table.
 	RenameColumn(hood *Hood, table, from, to string) error
@@ -99,7 +119,7 @@ type Dialect interface {
 	ChangeColumn(hood *Hood, table, column string, typ interface{}, size int) error
 
 	// ChangeColumnSql returns the sql for changing the column data type.
-	ChangeColumnSql(table, column string, typ interface{}, size int) string
+	ChangeColumnSql(table, column string, typ interface{}, size int) (string, error)
 
 	// DropColumn removes the specified column.
 	DropColumn(hood *Hood, table, column string) error
@@ -119,6 +139,43 @@ type Dialect interface {
 	// DropIndexSql returns the sql for dropping the index.
 	DropIndexSql(name string) string
 
+	// ForeignKeySql returns the definition of the foreign key constraint, as
+	// used in CREATE TABLE and ALTER TABLE statements.
+	ForeignKeySql(fk *ForeignKey) string
+
+	// AddForeignKey adds the foreign key constraint to table.
+	AddForeignKey(hood *Hood, table string, fk *ForeignKey) error
+
+	// AddForeignKeySql returns the sql for adding the foreign key constraint.
+	AddForeignKeySql(table string, fk *ForeignKey) string
+
+	// DropForeignKey drops the named foreign key constraint from table.
+	DropForeignKey(hood *Hood, table, name string) error
+
+	// DropForeignKeySql returns the sql for dropping the foreign key constraint.
+	DropForeignKeySql(table, name string) string
+
+	// SavepointSql returns the sql for creating a savepoint inside a
+	// transaction.
+	SavepointSql(name string) string
+
+	// ReleaseSavepointSql returns the sql for releasing a savepoint, or an
+	// empty string if savepoints cannot be released.
+	ReleaseSavepointSql(name string) string
+
+	// RollbackToSavepointSql returns the sql for rolling back to a savepoint.
+	RollbackToSavepointSql(name string) string
+
+	// IsRetryable returns true if err is a serialization failure or deadlock,
+	// after which the transaction can be retried.
+	IsRetryable(err error) bool
+
+	// ConvertError converts constraint violations reported by the driver into
+	// *UniqueViolationError, *ForeignKeyViolationError, *NotNullViolationError
+	// or *CheckViolationError. Other errors, including errors that already
+	// are one of these types, are returned unchanged.
+	ConvertError(err error) error
+
 	// KeywordNotNull returns the dialect specific keyword for 'NOT NULL'.
 	KeywordNotNull() string
 
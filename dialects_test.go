@@ -2,6 +2,14 @@ package hood
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -13,15 +21,25 @@ import (
 //
 // TO ENABLE/DISABLE LIVE TESTS UNCOMMENT/COMMENT THE CORRESPONDING DIALECT
 // INFO IN THE TO_RUN ARRAY!
+//
+// THE SQL GENERATION TESTS DO NOT NEED A DATABASE AND ALWAYS RUN FOR ALL
+// DIALECTS IN THE ALL_DIALECT_INFOS ARRAY.
 
 import (
-	_ "github.com/lib/pq"
+	mssqldrv "github.com/denisenkom/go-mssqldb"
+	gomysqldrv "github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	_ "github.com/ziutek/mymysql/godrv"
+	mymysqldrv "github.com/ziutek/mymysql/mysql"
 )
 
 var toRun = []dialectInfo{
 // allDialectInfos[0],
 // allDialectInfos[1],
+// allDialectInfos[2],
+// allDialectInfos[3],
+// allDialectInfos[4],
 }
 
 var allDialectInfos = []dialectInfo{
@@ -49,6 +67,23 @@ var allDialectInfos = []dialectInfo{
 		`CREATE UNIQUE INDEX "iname" ON "itable" ("a", "b", "c")`,
 		`CREATE INDEX "iname2" ON "itable2" ("d", "e")`,
 		`DROP INDEX "iname"`,
+		`SELECT * FROM "users" WHERE "a" = $1 AND ("b" = $2 OR ("c" = $3 AND "d" = $4)) OR "e" = $5`,
+		`SELECT * FROM "users" WHERE "id" IN ($1, $2, $3) AND 1 = 1 AND "deleted" IS NULL AND "age" BETWEEN $4 AND $5 OR "name" LIKE $6`,
+		`SELECT SUM("orders"."price") FROM "orders" INNER JOIN "users" ON "orders"."user_id" = "users"."id" WHERE "users"."name" = $1 GROUP BY "users"."name"`,
+		`SAVEPOINT "sp"`,
+		`RELEASE SAVEPOINT "sp"`,
+		`ROLLBACK TO SAVEPOINT "sp"`,
+		`CREATE TABLE "json_model" ( "id" bigserial PRIMARY KEY, "settings" jsonb, "tags" jsonb )`,
+		`CREATE TABLE "uuid_model" ( "id" uuid PRIMARY KEY, "name" text )`,
+		`INSERT INTO "uuid_model" ("id", "name") VALUES ($1, $2)`,
+		`CREATE TABLE "composite_model" ( "user_id" bigint, "role_id" bigint, "note" text, PRIMARY KEY ("user_id", "role_id") )`,
+		`UPDATE "composite_model" SET "note" = $1 WHERE "user_id" = $2 AND "role_id" = $3`,
+		`DELETE FROM "composite_model" WHERE "user_id" = $1 AND "role_id" = $2`,
+		`CREATE TABLE "fk_model" ( "id" bigserial PRIMARY KEY, "user_id" bigint, CONSTRAINT "fk_model_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE )`,
+		`ALTER TABLE "fk_model" ADD COLUMN "user_id" bigint, ADD CONSTRAINT "fk_model_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE SET NULL`,
+		`ALTER TABLE "fk_model" ADD CONSTRAINT "fk_model_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE SET NULL ON UPDATE CASCADE`,
+		`ALTER TABLE "fk_model" DROP CONSTRAINT "fk_model_user_id_fkey"`,
+		`WITH "source" AS (SELECT "row", nextval(pg_get_serial_sequence('"sql_gen_model"', 'prim')) AS "prim" FROM generate_series(0, 1) AS "row"), "inserted" AS (INSERT INTO "sql_gen_model" ("prim", "first", "last", "amount") VALUES ((SELECT "prim" FROM "source" WHERE "row" = 0), $1, $2, $3), ((SELECT "prim" FROM "source" WHERE "row" = 1), $4, $5, $6)) SELECT "row", "prim" FROM "source"`,
 	},
 	dialectInfo{
 		NewMysql(),
@@ -74,6 +109,149 @@ var allDialectInfos = []dialectInfo{
 		"CREATE UNIQUE INDEX `iname` ON `itable` (`a`, `b`, `c`)",
 		"CREATE INDEX `iname2` ON `itable2` (`d`, `e`)",
 		"DROP INDEX `iname`",
+		"SELECT * FROM `users` WHERE `a` = ? AND (`b` = ? OR (`c` = ? AND `d` = ?)) OR `e` = ?",
+		"SELECT * FROM `users` WHERE `id` IN (?, ?, ?) AND 1 = 1 AND `deleted` IS NULL AND `age` BETWEEN ? AND ? OR `name` LIKE ?",
+		"SELECT SUM(`orders`.`price`) FROM `orders` INNER JOIN `users` ON `orders`.`user_id` = `users`.`id` WHERE `users`.`name` = ? GROUP BY `users`.`name`",
+		"SAVEPOINT `sp`",
+		"RELEASE SAVEPOINT `sp`",
+		"ROLLBACK TO SAVEPOINT `sp`",
+		"CREATE TABLE `json_model` ( `id` bigint PRIMARY KEY AUTO_INCREMENT, `settings` json, `tags` json )",
+		"CREATE TABLE `uuid_model` ( `id` char(36) PRIMARY KEY, `name` longtext )",
+		"INSERT INTO `uuid_model` (`id`, `name`) VALUES (?, ?)",
+		"CREATE TABLE `composite_model` ( `user_id` bigint, `role_id` bigint, `note` longtext, PRIMARY KEY (`user_id`, `role_id`) )",
+		"UPDATE `composite_model` SET `note` = ? WHERE `user_id` = ? AND `role_id` = ?",
+		"DELETE FROM `composite_model` WHERE `user_id` = ? AND `role_id` = ?",
+		"CREATE TABLE `fk_model` ( `id` bigint PRIMARY KEY AUTO_INCREMENT, `user_id` bigint, CONSTRAINT `fk_model_user_id_fkey` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE )",
+		"ALTER TABLE `fk_model` ADD COLUMN `user_id` bigint, ADD CONSTRAINT `fk_model_user_id_fkey` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE SET NULL",
+		"ALTER TABLE `fk_model` ADD CONSTRAINT `fk_model_user_id_fkey` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE SET NULL ON UPDATE CASCADE",
+		"ALTER TABLE `fk_model` DROP FOREIGN KEY `fk_model_user_id_fkey`",
+		"INSERT INTO `sql_gen_model` (`first`, `last`, `amount`) VALUES (?, ?, ?), (?, ?, ?)",
+	},
+	dialectInfo{
+		NewSqlite3(),
+		setupSqlite3,
+		`CREATE TABLE "without_pk" ( "first" text, "last" text, "amount" integer )`,
+		`CREATE TABLE IF NOT EXISTS "without_pk" ( "first" text, "last" text, "amount" integer )`,
+		`CREATE TABLE "with_pk" ( "primary" integer PRIMARY KEY AUTOINCREMENT, "first" text, "last" text, "amount" integer )`,
+		`INSERT INTO "sql_gen_model" ("first", "last", "amount") VALUES (?, ?, ?)`,
+		`UPDATE "sql_gen_model" SET "first" = ?, "last" = ?, "amount" = ? WHERE "prim" = ?`,
+		`DELETE FROM "sql_gen_model" WHERE "prim" = ?`,
+		`DELETE FROM "sql_del_from" WHERE "a" = ? AND "b" > ? OR "c" < ?`,
+		`SELECT * FROM "sql_gen_model"`,
+		`SELECT "col1", "col2" FROM "sql_gen_model" INNER JOIN "orders" ON "sql_gen_model"."id1" = "orders"."id2" WHERE "user"."id" = "order"."id" AND "a" > ? OR "b" < ? AND "c" = ? OR "d" = ? GROUP BY "user"."name" HAVING SUM(price) < ? ORDER BY "user"."first_name" LIMIT ? OFFSET ?`,
+		`SELECT "col1", "col2" FROM "sql_gen_model" INNER JOIN "orders" ON "sql_gen_model"."id1" = "orders"."id2" WHERE "user"."id" = "order"."id" AND "a" > ? OR "b" < ? AND "c" = ? OR "d" = ? GROUP BY "user"."name" HAVING SUM(price) < ? ORDER BY "user"."first_name" ASC LIMIT ? OFFSET ?`,
+		`SELECT "col1", "col2" FROM "sql_gen_model" INNER JOIN "orders" ON "sql_gen_model"."id1" = "orders"."id2" WHERE "user"."id" = "order"."id" AND "a" > ? OR "b" < ? AND "c" = ? OR "d" = ? GROUP BY "user"."name" HAVING SUM(price) < ? ORDER BY "user"."first_name" DESC LIMIT ? OFFSET ?`,
+		`DROP TABLE "drop_table"`,
+		`DROP TABLE IF EXISTS "drop_table"`,
+		`ALTER TABLE "table_a" RENAME TO "table_b"`,
+		`ALTER TABLE "a" ADD COLUMN "c" varchar(100)`,
+		`ALTER TABLE "a" RENAME COLUMN "b" TO "c"`,
+		"",
+		`ALTER TABLE "a" DROP COLUMN "b"`,
+		`CREATE UNIQUE INDEX "iname" ON "itable" ("a", "b", "c")`,
+		`CREATE INDEX "iname2" ON "itable2" ("d", "e")`,
+		`DROP INDEX "iname"`,
+		`SELECT * FROM "users" WHERE "a" = ? AND ("b" = ? OR ("c" = ? AND "d" = ?)) OR "e" = ?`,
+		`SELECT * FROM "users" WHERE "id" IN (?, ?, ?) AND 1 = 1 AND "deleted" IS NULL AND "age" BETWEEN ? AND ? OR "name" LIKE ?`,
+		`SELECT SUM("orders"."price") FROM "orders" INNER JOIN "users" ON "orders"."user_id" = "users"."id" WHERE "users"."name" = ? GROUP BY "users"."name"`,
+		`SAVEPOINT "sp"`,
+		`RELEASE SAVEPOINT "sp"`,
+		`ROLLBACK TO SAVEPOINT "sp"`,
+		`CREATE TABLE "json_model" ( "id" integer PRIMARY KEY AUTOINCREMENT, "settings" text, "tags" text )`,
+		`CREATE TABLE "uuid_model" ( "id" char(36) PRIMARY KEY, "name" text )`,
+		`INSERT INTO "uuid_model" ("id", "name") VALUES (?, ?)`,
+		`CREATE TABLE "composite_model" ( "user_id" integer, "role_id" integer, "note" text, PRIMARY KEY ("user_id", "role_id") )`,
+		`UPDATE "composite_model" SET "note" = ? WHERE "user_id" = ? AND "role_id" = ?`,
+		`DELETE FROM "composite_model" WHERE "user_id" = ? AND "role_id" = ?`,
+		`CREATE TABLE "fk_model" ( "id" integer PRIMARY KEY AUTOINCREMENT, "user_id" integer, CONSTRAINT "fk_model_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE )`,
+		`ALTER TABLE "fk_model" ADD COLUMN "user_id" integer CONSTRAINT "fk_model_user_id_fkey" REFERENCES "users" ("id") ON DELETE SET NULL`,
+		`ALTER TABLE "fk_model" ADD CONSTRAINT "fk_model_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE SET NULL ON UPDATE CASCADE`,
+		`ALTER TABLE "fk_model" DROP CONSTRAINT "fk_model_user_id_fkey"`,
+		"INSERT INTO \"sql_gen_model\" (\"first\", \"last\", \"amount\") VALUES (?, ?, ?), (?, ?, ?)",
+	},
+	dialectInfo{
+		NewGoMysql(),
+		setupGoMysql,
+		"CREATE TABLE `without_pk` ( `first` longtext, `last` longtext, `amount` int )",
+		"CREATE TABLE IF NOT EXISTS `without_pk` ( `first` longtext, `last` longtext, `amount` int )",
+		"CREATE TABLE `with_pk` ( `primary` bigint PRIMARY KEY AUTO_INCREMENT, `first` longtext, `last` longtext, `amount` int )",
+		"INSERT INTO `sql_gen_model` (`first`, `last`, `amount`) VALUES (?, ?, ?)",
+		"UPDATE `sql_gen_model` SET `first` = ?, `last` = ?, `amount` = ? WHERE `prim` = ?",
+		"DELETE FROM `sql_gen_model` WHERE `prim` = ?",
+		"DELETE FROM `sql_del_from` WHERE `a` = ? AND `b` > ? OR `c` < ?",
+		"SELECT * FROM `sql_gen_model`",
+		"SELECT `col1`, `col2` FROM `sql_gen_model` INNER JOIN `orders` ON `sql_gen_model`.`id1` = `orders`.`id2` WHERE `user`.`id` = `order`.`id` AND `a` > ? OR `b` < ? AND `c` = ? OR `d` = ? GROUP BY `user`.`name` HAVING SUM(price) < ? ORDER BY `user`.`first_name` LIMIT ? OFFSET ?",
+		"SELECT `col1`, `col2` FROM `sql_gen_model` INNER JOIN `orders` ON `sql_gen_model`.`id1` = `orders`.`id2` WHERE `user`.`id` = `order`.`id` AND `a` > ? OR `b` < ? AND `c` = ? OR `d` = ? GROUP BY `user`.`name` HAVING SUM(price) < ? ORDER BY `user`.`first_name` ASC LIMIT ? OFFSET ?",
+		"SELECT `col1`, `col2` FROM `sql_gen_model` INNER JOIN `orders` ON `sql_gen_model`.`id1` = `orders`.`id2` WHERE `user`.`id` = `order`.`id` AND `a` > ? OR `b` < ? AND `c` = ? OR `d` = ? GROUP BY `user`.`name` HAVING SUM(price) < ? ORDER BY `user`.`first_name` DESC LIMIT ? OFFSET ?",
+		"DROP TABLE `drop_table`",
+		"DROP TABLE IF EXISTS `drop_table`",
+		"ALTER TABLE `table_a` RENAME TO `table_b`",
+		"ALTER TABLE `a` ADD COLUMN `c` varchar(100)",
+		"ALTER TABLE `a` RENAME COLUMN `b` TO `c`",
+		"ALTER TABLE `a` ALTER COLUMN `b` TYPE varchar(100)",
+		"ALTER TABLE `a` DROP COLUMN `b`",
+		"CREATE UNIQUE INDEX `iname` ON `itable` (`a`, `b`, `c`)",
+		"CREATE INDEX `iname2` ON `itable2` (`d`, `e`)",
+		"DROP INDEX `iname`",
+		"SELECT * FROM `users` WHERE `a` = ? AND (`b` = ? OR (`c` = ? AND `d` = ?)) OR `e` = ?",
+		"SELECT * FROM `users` WHERE `id` IN (?, ?, ?) AND 1 = 1 AND `deleted` IS NULL AND `age` BETWEEN ? AND ? OR `name` LIKE ?",
+		"SELECT SUM(`orders`.`price`) FROM `orders` INNER JOIN `users` ON `orders`.`user_id` = `users`.`id` WHERE `users`.`name` = ? GROUP BY `users`.`name`",
+		"SAVEPOINT `sp`",
+		"RELEASE SAVEPOINT `sp`",
+		"ROLLBACK TO SAVEPOINT `sp`",
+		"CREATE TABLE `json_model` ( `id` bigint PRIMARY KEY AUTO_INCREMENT, `settings` json, `tags` json )",
+		"CREATE TABLE `uuid_model` ( `id` char(36) PRIMARY KEY, `name` longtext )",
+		"INSERT INTO `uuid_model` (`id`, `name`) VALUES (?, ?)",
+		"CREATE TABLE `composite_model` ( `user_id` bigint, `role_id` bigint, `note` longtext, PRIMARY KEY (`user_id`, `role_id`) )",
+		"UPDATE `composite_model` SET `note` = ? WHERE `user_id` = ? AND `role_id` = ?",
+		"DELETE FROM `composite_model` WHERE `user_id` = ? AND `role_id` = ?",
+		"CREATE TABLE `fk_model` ( `id` bigint PRIMARY KEY AUTO_INCREMENT, `user_id` bigint, CONSTRAINT `fk_model_user_id_fkey` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE )",
+		"ALTER TABLE `fk_model` ADD COLUMN `user_id` bigint, ADD CONSTRAINT `fk_model_user_id_fkey` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE SET NULL",
+		"ALTER TABLE `fk_model` ADD CONSTRAINT `fk_model_user_id_fkey` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE SET NULL ON UPDATE CASCADE",
+		"ALTER TABLE `fk_model` DROP FOREIGN KEY `fk_model_user_id_fkey`",
+		"INSERT INTO `sql_gen_model` (`first`, `last`, `amount`) VALUES (?, ?, ?), (?, ?, ?)",
+	},
+	dialectInfo{
+		NewMssql(),
+		setupMssql,
+		"CREATE TABLE [without_pk] ( [first] nvarchar(max), [last] nvarchar(max), [amount] int )",
+		"IF OBJECT_ID('without_pk', 'U') IS NULL CREATE TABLE [without_pk] ( [first] nvarchar(max), [last] nvarchar(max), [amount] int )",
+		"CREATE TABLE [with_pk] ( [primary] bigint PRIMARY KEY IDENTITY(1,1), [first] nvarchar(max), [last] nvarchar(max), [amount] int )",
+		"INSERT INTO [sql_gen_model] ([first], [last], [amount]) OUTPUT INSERTED.[prim] VALUES (@p1, @p2, @p3)",
+		"UPDATE [sql_gen_model] SET [first] = @p1, [last] = @p2, [amount] = @p3 WHERE [prim] = @p4",
+		"DELETE FROM [sql_gen_model] WHERE [prim] = @p1",
+		"DELETE FROM [sql_del_from] WHERE [a] = @p1 AND [b] > @p2 OR [c] < @p3",
+		"SELECT * FROM [sql_gen_model]",
+		"SELECT [col1], [col2] FROM [sql_gen_model] INNER JOIN [orders] ON [sql_gen_model].[id1] = [orders].[id2] WHERE [user].[id] = [order].[id] AND [a] > @p1 OR [b] < @p2 AND [c] = @p3 OR [d] = @p4 GROUP BY [user].[name] HAVING SUM(price) < @p5 ORDER BY [user].[first_name] OFFSET @p6 ROWS FETCH NEXT @p7 ROWS ONLY",
+		"SELECT [col1], [col2] FROM [sql_gen_model] INNER JOIN [orders] ON [sql_gen_model].[id1] = [orders].[id2] WHERE [user].[id] = [order].[id] AND [a] > @p1 OR [b] < @p2 AND [c] = @p3 OR [d] = @p4 GROUP BY [user].[name] HAVING SUM(price) < @p5 ORDER BY [user].[first_name] ASC OFFSET @p6 ROWS FETCH NEXT @p7 ROWS ONLY",
+		"SELECT [col1], [col2] FROM [sql_gen_model] INNER JOIN [orders] ON [sql_gen_model].[id1] = [orders].[id2] WHERE [user].[id] = [order].[id] AND [a] > @p1 OR [b] < @p2 AND [c] = @p3 OR [d] = @p4 GROUP BY [user].[name] HAVING SUM(price) < @p5 ORDER BY [user].[first_name] DESC OFFSET @p6 ROWS FETCH NEXT @p7 ROWS ONLY",
+		"DROP TABLE [drop_table]",
+		"DROP TABLE IF EXISTS [drop_table]",
+		"EXEC sp_rename 'table_a', 'table_b'",
+		"ALTER TABLE [a] ADD [c] nvarchar(100)",
+		"EXEC sp_rename 'a.b', 'c', 'COLUMN'",
+		"ALTER TABLE [a] ALTER COLUMN [b] nvarchar(100)",
+		"ALTER TABLE [a] DROP COLUMN [b]",
+		"CREATE UNIQUE INDEX [iname] ON [itable] ([a], [b], [c])",
+		"CREATE INDEX [iname2] ON [itable2] ([d], [e])",
+		"DECLARE @sql nvarchar(max) = (SELECT 'DROP INDEX [iname] ON ' + QUOTENAME(OBJECT_NAME(object_id)) FROM sys.indexes WHERE name = 'iname'); EXEC(@sql)",
+		"SELECT * FROM [users] WHERE [a] = @p1 AND ([b] = @p2 OR ([c] = @p3 AND [d] = @p4)) OR [e] = @p5",
+		"SELECT * FROM [users] WHERE [id] IN (@p1, @p2, @p3) AND 1 = 1 AND [deleted] IS NULL AND [age] BETWEEN @p4 AND @p5 OR [name] LIKE @p6",
+		"SELECT SUM([orders].[price]) FROM [orders] INNER JOIN [users] ON [orders].[user_id] = [users].[id] WHERE [users].[name] = @p1 GROUP BY [users].[name]",
+		"SAVE TRANSACTION [sp]",
+		"",
+		"ROLLBACK TRANSACTION [sp]",
+		"CREATE TABLE [json_model] ( [id] bigint PRIMARY KEY IDENTITY(1,1), [settings] nvarchar(max), [tags] nvarchar(max) )",
+		"CREATE TABLE [uuid_model] ( [id] char(36) PRIMARY KEY, [name] nvarchar(max) )",
+		"INSERT INTO [uuid_model] ([id], [name]) VALUES (@p1, @p2)",
+		`CREATE TABLE [composite_model] ( [user_id] bigint, [role_id] bigint, [note] nvarchar(max), PRIMARY KEY ([user_id], [role_id]) )`,
+		`UPDATE [composite_model] SET [note] = @p1 WHERE [user_id] = @p2 AND [role_id] = @p3`,
+		`DELETE FROM [composite_model] WHERE [user_id] = @p1 AND [role_id] = @p2`,
+		`CREATE TABLE [fk_model] ( [id] bigint PRIMARY KEY IDENTITY(1,1), [user_id] bigint, CONSTRAINT [fk_model_user_id_fkey] FOREIGN KEY ([user_id]) REFERENCES [users] ([id]) ON DELETE CASCADE )`,
+		`ALTER TABLE [fk_model] ADD [user_id] bigint, CONSTRAINT [fk_model_user_id_fkey] FOREIGN KEY ([user_id]) REFERENCES [users] ([id]) ON DELETE SET NULL`,
+		`ALTER TABLE [fk_model] ADD CONSTRAINT [fk_model_user_id_fkey] FOREIGN KEY ([user_id]) REFERENCES [users] ([id]) ON DELETE SET NULL ON UPDATE CASCADE`,
+		`ALTER TABLE [fk_model] DROP CONSTRAINT [fk_model_user_id_fkey]`,
+		"MERGE INTO [sql_gen_model] USING (VALUES (@p1, @p2, @p3, 0), (@p4, @p5, @p6, 1)) AS [source] ([first], [last], [amount], [row]) ON 1 = 0 WHEN NOT MATCHED THEN INSERT ([first], [last], [amount]) VALUES ([source].[first], [source].[last], [source].[amount]) OUTPUT [source].[row], INSERTED.[prim];",
 	},
 }
 
@@ -101,6 +279,23 @@ type dialectInfo struct {
 	createUniqueIndexSql            string
 	createIndexSql                  string
 	dropIndexSql                    string
+	groupedQuerySql                 string
+	operatorQuerySql                string
+	aggregateQuerySql               string
+	savepointSql                    string
+	releaseSavepointSql             string
+	rollbackToSavepointSql          string
+	createTableWithJsonSql          string
+	createTableWithUUIDSql          string
+	insertWithUUIDSql               string
+	createTableWithCompositePkSql   string
+	updateWithCompositePkSql        string
+	deleteWithCompositePkSql        string
+	createTableWithForeignKeySql    string
+	addColumnWithForeignKeySql      string
+	addForeignKeySql                string
+	dropForeignKeySql               string
+	insertAllSql                    string
 }
 
 func setupPgDb(t *testing.T) *Hood {
@@ -124,6 +319,44 @@ func setupMysql(t *testing.T) *Hood {
 	return hd
 }
 
+func setupGoMysql(t *testing.T) *Hood {
+	db, err := sql.Open("mysql", "hood:@unix(/Applications/MAMP/tmp/mysql/mysql.sock)/hood_test")
+	if err != nil {
+		t.Fatal("could not open db", err)
+	}
+	hd := New(db, NewGoMysql())
+	hd.Log = true
+	return hd
+}
+
+func setupMssql(t *testing.T) *Hood {
+	db, err := sql.Open("mssql", "server=localhost;user id=hood;database=hood_test")
+	if err != nil {
+		t.Fatal("could not open db", err)
+	}
+	hd := New(db, NewMssql())
+	hd.Log = true
+	return hd
+}
+
+func setupSqlite3(t *testing.T) *Hood {
+	db, err := sql.Open("sqlite3", filepath.Join(os.TempDir(), "hood_test.sqlite3")+"?_foreign_keys=1")
+	if err != nil {
+		t.Fatal("could not open db", err)
+	}
+	hd := New(db, NewSqlite3())
+	hd.Log = true
+	return hd
+}
+
+func mustBegin(t *testing.T, hd *Hood) *Hood {
+	tx, err := hd.Begin()
+	if err != nil {
+		t.Fatal("could not begin transaction", err)
+	}
+	return tx
+}
+
 func TestTransaction(t *testing.T) {
 	for _, info := range toRun {
 		DoTestTransaction(t, info)
@@ -142,14 +375,14 @@ func DoTestTransaction(t *testing.T, info dialectInfo) {
 	}
 
 	hd.DropTable(&table)
-	tx := hd.Begin()
+	tx := mustBegin(t, hd)
 	tx.CreateTable(&table)
 	err := tx.Commit()
 	if err != nil {
 		t.Fatal("error not nil", err)
 	}
 
-	tx = hd.Begin()
+	tx = mustBegin(t, hd)
 	if _, ok := hd.qo.(*sql.DB); !ok {
 		t.Fatal("wrong type")
 	}
@@ -174,7 +407,7 @@ func DoTestTransaction(t *testing.T, info dialectInfo) {
 		t.Fatal("wrong length", x)
 	}
 
-	tx = hd.Begin()
+	tx = mustBegin(t, hd)
 	table.Id = 0 // force insert by resetting id
 	_, err = tx.Save(&table)
 	if err != nil {
@@ -195,6 +428,119 @@ func DoTestTransaction(t *testing.T, info dialectInfo) {
 	}
 }
 
+func TestNestedTransaction(t *testing.T) {
+	for _, info := range toRun {
+		DoTestNestedTransaction(t, info)
+	}
+}
+
+func DoTestNestedTransaction(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hd := info.setupDbFunc(t)
+	type nestedTxModel struct {
+		Id Id
+		A  string
+	}
+
+	hd.DropTable(&nestedTxModel{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&nestedTxModel{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+
+	tx = mustBegin(t, hd)
+	_, err = tx.Save(&nestedTxModel{A: "outer"})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	inner := mustBegin(t, tx)
+	if !inner.IsTransaction() {
+		t.Fatal("should be a transaction")
+	}
+	_, err = inner.Save(&nestedTxModel{A: "rolled back"})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	err = inner.Rollback()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	inner = mustBegin(t, tx)
+	_, err = inner.Save(&nestedTxModel{A: "released"})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	innermost := mustBegin(t, inner)
+	_, err = innermost.Save(&nestedTxModel{A: "innermost"})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	err = innermost.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	err = inner.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+
+	var out []nestedTxModel
+	err = hd.OrderBy("id").Find(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	names := []string{}
+	for _, m := range out {
+		names = append(names, m.A)
+	}
+	if !reflect.DeepEqual(names, []string{"outer", "released", "innermost"}) {
+		t.Fatal("wrong rows", names)
+	}
+}
+
+func TestConstraintViolation(t *testing.T) {
+	for _, info := range toRun {
+		DoTestConstraintViolation(t, info)
+	}
+}
+
+func DoTestConstraintViolation(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hd := info.setupDbFunc(t)
+	type constraintModel struct {
+		Id    Id
+		Email string `sql:"size(128)"`
+	}
+
+	hd.DropTable(&constraintModel{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&constraintModel{})
+	tx.CreateIndex(&constraintModel{}, "email_index", true, "email")
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+
+	_, err = hd.Save(&constraintModel{Email: "a@b.c"})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	_, err = hd.Save(&constraintModel{Email: "a@b.c"})
+	var uniqueErr *UniqueViolationError
+	if !errors.As(err, &uniqueErr) {
+		t.Fatalf("wrong error %T %v", err, err)
+	}
+	if uniqueErr.Unwrap() == nil || isConstraintViolation(uniqueErr.Unwrap()) {
+		t.Fatal("driver error not set", uniqueErr.Unwrap())
+	}
+}
+
 func TestSaveAndDelete(t *testing.T) {
 	for _, info := range toRun {
 		DoTestSaveAndDelete(t, info)
@@ -227,7 +573,7 @@ func DoTestSaveAndDelete(t *testing.T, info dialectInfo) {
 
 	hd.DropTable(&model1)
 
-	tx := hd.Begin()
+	tx := mustBegin(t, hd)
 	tx.CreateTable(&model1)
 	err := tx.Commit()
 	if err != nil {
@@ -237,7 +583,7 @@ func DoTestSaveAndDelete(t *testing.T, info dialectInfo) {
 	if err != nil {
 		t.Fatal("error not nil", err)
 	}
-	if id != 1 {
+	if id != Id(1) {
 		t.Fatal("wrong id", id)
 	}
 	if x := model1.Created; x.Sub(now) <= 0 {
@@ -274,7 +620,7 @@ func DoTestSaveAndDelete(t *testing.T, info dialectInfo) {
 	if err != nil {
 		t.Fatal("error not nil", err)
 	}
-	if id != 1 {
+	if id != Id(1) {
 		t.Fatal("wrong id", id)
 	}
 	if x := model1.Created; !x.Equal(oldCreate.Time) {
@@ -307,7 +653,7 @@ func DoTestSaveAndDelete(t *testing.T, info dialectInfo) {
 	if err != nil {
 		t.Fatal("error not nil", err)
 	}
-	if id != 2 {
+	if id != Id(2) {
 		t.Fatal("wrong id", id)
 	}
 	if model2.Id != id {
@@ -387,7 +733,7 @@ func DoTestSaveDeleteAllAndHooks(t *testing.T, info dialectInfo) {
 	}
 
 	sdAllHooks = make([]string, 0, 20)
-	tx := hd.Begin()
+	tx := mustBegin(t, hd)
 	tx.CreateTable(&sdAllModel{})
 	err := tx.Commit()
 	if err != nil {
@@ -401,10 +747,10 @@ func DoTestSaveDeleteAllAndHooks(t *testing.T, info dialectInfo) {
 	if x := len(ids); x != 2 {
 		t.Fatal("wrong id count", x)
 	}
-	if x := ids[0]; x != 1 {
+	if x := ids[0]; x != Id(1) {
 		t.Fatal("wrong id", x)
 	}
-	if x := ids[1]; x != 2 {
+	if x := ids[1]; x != Id(2) {
 		t.Fatal("wrong id", x)
 	}
 	if x := models[0].Id; x != 1 {
@@ -504,7 +850,7 @@ func DoTestFind(t *testing.T, info dialectInfo) {
 
 	hd.DropTable(&model1)
 
-	tx := hd.Begin()
+	tx := mustBegin(t, hd)
 	tx.CreateTable(&model1)
 	err := tx.Commit()
 	if err != nil {
@@ -524,7 +870,7 @@ func DoTestFind(t *testing.T, info dialectInfo) {
 	if err != nil {
 		t.Fatal("error not nil", err)
 	}
-	if id != 1 {
+	if id != Id(1) {
 		t.Fatal("wrong id", id)
 	}
 
@@ -596,7 +942,7 @@ func DoTestFind(t *testing.T, info dialectInfo) {
 	if err != nil {
 		t.Fatal("error not nil", err)
 	}
-	if id != 2 {
+	if id != Id(2) {
 		t.Fatal("wrong id", id)
 	}
 
@@ -619,6 +965,181 @@ func DoTestFind(t *testing.T, info dialectInfo) {
 	}
 }
 
+func TestFindShapes(t *testing.T) {
+	for _, info := range toRun {
+		DoTestFindShapes(t, info)
+	}
+}
+
+func DoTestFindShapes(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hd := info.setupDbFunc(t)
+
+	type shapeModel struct {
+		Id   Id
+		Name string
+		Age  int
+	}
+
+	hd.DropTable(&shapeModel{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&shapeModel{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	var first shapeModel
+	err = hd.First(&first)
+	if err != ErrNotFound {
+		t.Fatal("wrong error", err)
+	}
+	models := []shapeModel{
+		{Name: "a", Age: 10},
+		{Name: "b", Age: 20},
+		{Name: "c", Age: 30},
+	}
+	_, err = hd.SaveAll(&models)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	err = hd.Where("age", ">", 10).OrderBy("age").First(&first)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if first.Name != "b" || first.Id != models[1].Id {
+		t.Fatal("wrong row", first)
+	}
+	var names []string
+	err = hd.Select(&shapeModel{}).OrderBy("name").Pluck("name", &names)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Fatal("wrong names", names)
+	}
+	var ages []int64
+	err = hd.Select(&shapeModel{}).Where("name", "=", "c").Pluck("age", &ages)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if !reflect.DeepEqual(ages, []int64{30}) {
+		t.Fatal("wrong ages", ages)
+	}
+	maps, err := hd.Select(&shapeModel{}, "name", "age").OrderBy("age").FindMaps()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x := len(maps); x != 3 {
+		t.Fatal("wrong row count", x)
+	}
+	if x := len(maps[0]); x != 2 {
+		t.Fatal("wrong column count", x)
+	}
+	if maps[2]["age"] == nil || maps[2]["name"] == nil {
+		t.Fatal("missing values", maps[2])
+	}
+}
+
+func TestIterateAndBatches(t *testing.T) {
+	for _, info := range toRun {
+		DoTestIterateAndBatches(t, info)
+	}
+}
+
+func DoTestIterateAndBatches(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hd := info.setupDbFunc(t)
+
+	type batchModel struct {
+		Id   Id
+		Name string
+		Odd  bool
+	}
+
+	hd.DropTable(&batchModel{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&batchModel{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	models := []batchModel{}
+	for i := 0; i < 7; i++ {
+		models = append(models, batchModel{Name: fmt.Sprintf("n%d", i), Odd: i%2 == 1})
+	}
+	_, err = hd.SaveAll(&models)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	it, err := hd.Where("odd", "=", false).OrderBy("id").Iterate(&batchModel{})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	names := []string{}
+	for it.Next() {
+		var m batchModel
+		err = it.Scan(&m)
+		if err != nil {
+			t.Fatal("error not nil", err)
+		}
+		names = append(names, m.Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if err := it.Close(); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if !reflect.DeepEqual(names, []string{"n0", "n2", "n4", "n6"}) {
+		t.Fatal("wrong names", names)
+	}
+	var batch []batchModel
+	sizes := []int{}
+	names = []string{}
+	err = hd.Where("odd", "=", false).Or("name", "=", "n5").FindInBatches(&batch, 2, func() error {
+		sizes = append(sizes, len(batch))
+		for _, m := range batch {
+			names = append(names, m.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if !reflect.DeepEqual(sizes, []int{2, 2, 1}) {
+		t.Fatal("wrong batch sizes", sizes)
+	}
+	if !reflect.DeepEqual(names, []string{"n0", "n2", "n4", "n5", "n6"}) {
+		t.Fatal("wrong names", names)
+	}
+	// the key is selected to page, even if it isn't selected explicitly
+	names = []string{}
+	err = hd.Select(&batchModel{}, "name").FindInBatches(&batch, 3, func() error {
+		for _, m := range batch {
+			names = append(names, m.Name)
+		}
+		if len(names) > 7 {
+			return errors.New("rows loaded again")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x := len(names); x != 7 {
+		t.Fatal("wrong row count", x)
+	}
+	stop := errors.New("stop")
+	calls := 0
+	err = hd.FindInBatches(&batch, 3, func() error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Fatal("should stop on error", err, calls)
+	}
+}
+
 func TestCreateTable(t *testing.T) {
 	for _, info := range toRun {
 		DoTestCreateTable(t, info)
@@ -644,7 +1165,7 @@ func DoTestCreateTable(t *testing.T, info dialectInfo) {
 	if err != nil {
 		t.Fatal("error not nil", err)
 	}
-	tx := hd.Begin()
+	tx := mustBegin(t, hd)
 	tx.CreateTable(table)
 	err = tx.Commit()
 	if err != nil {
@@ -657,7 +1178,7 @@ func DoTestCreateTable(t *testing.T, info dialectInfo) {
 }
 
 func TestCreateTableSql(t *testing.T) {
-	for _, info := range toRun {
+	for _, info := range allDialectInfos {
 		DoTestCreateTableSql(t, info)
 	}
 }
@@ -674,10 +1195,10 @@ func DoTestCreateTableSql(t *testing.T, info dialectInfo) {
 	if err != nil {
 		t.Fatal("error not nil", err)
 	}
-	if x := info.dialect.CreateTableSql(model, false); x != info.createTableWithoutPkSql {
+	if x, _ := info.dialect.CreateTableSql(model, false); x != info.createTableWithoutPkSql {
 		t.Fatal("wrong sql", x)
 	}
-	if x := info.dialect.CreateTableSql(model, true); x != info.createTableWithoutPkIfExistsSql {
+	if x, _ := info.dialect.CreateTableSql(model, true); x != info.createTableWithoutPkIfExistsSql {
 		t.Fatal("wrong sql", x)
 	}
 	type withPk struct {
@@ -691,11 +1212,91 @@ func DoTestCreateTableSql(t *testing.T, info dialectInfo) {
 	if err != nil {
 		t.Fatal("error not nil", err)
 	}
-	if x := info.dialect.CreateTableSql(model, false); x != info.createTableWithPkSql {
+	if x, _ := info.dialect.CreateTableSql(model, false); x != info.createTableWithPkSql {
 		t.Fatal("wrong query", x)
 	}
 }
 
+func TestCreateTableWithIntegerPkSql(t *testing.T) {
+	type intPk struct {
+		Code int64 `sql:"pk"`
+		Name string
+	}
+	model, err := interfaceToModel(&intPk{})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	// MySQL keeps declaring integer keys tagged pk as AUTO_INCREMENT
+	want := "CREATE TABLE `int_pk` ( `code` bigint PRIMARY KEY AUTO_INCREMENT, `name` longtext )"
+	for _, d := range []Dialect{NewMysql(), NewGoMysql()} {
+		if x, _ := d.CreateTableSql(model, false); x != want {
+			t.Fatalf("%T: wrong sql %v", d, x)
+		}
+	}
+	want = "CREATE TABLE [int_pk] ( [code] bigint PRIMARY KEY, [name] nvarchar(max) )"
+	if x, _ := NewMssql().CreateTableSql(model, false); x != want {
+		t.Fatalf("wrong sql %v", x)
+	}
+	// zero keys are generated by MySQL, and have to be set elsewhere
+	if err := generatePk(NewMysql(), model); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x, _ := NewMysql().InsertSql(model); x != "INSERT INTO `int_pk` (`name`) VALUES (?)" {
+		t.Fatal("wrong sql", x)
+	}
+	if err := generatePk(NewMssql(), model); err != ErrPrimaryKeyNotSet {
+		t.Fatal("wrong error", err)
+	}
+	model.Pk.Value = int64(5)
+	if x, _ := NewMysql().InsertSql(model); x != "INSERT INTO `int_pk` (`code`, `name`) VALUES (?, ?)" {
+		t.Fatal("wrong sql", x)
+	}
+}
+
+func TestIntegerPkAutoIncrement(t *testing.T) {
+	for _, info := range toRun {
+		DoTestIntegerPkAutoIncrement(t, info)
+	}
+}
+
+func DoTestIntegerPkAutoIncrement(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	type intPkModel struct {
+		Code int64 `sql:"pk"`
+		Name string
+	}
+	hd := info.setupDbFunc(t)
+	hd.DropTableIfExists(&intPkModel{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&intPkModel{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	rows := []intPkModel{{Name: "a"}, {Code: 10, Name: "b"}, {Name: "c"}}
+	_, err = hd.InsertAll(&rows)
+	if _, ok := info.dialect.(integerPkAutoIncrementer); !ok {
+		if err != ErrPrimaryKeyNotSet {
+			t.Fatal("wrong error", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if rows[0].Code != 1 || rows[1].Code != 10 || rows[2].Code != 11 {
+		t.Fatal("wrong keys", rows)
+	}
+	row := intPkModel{Name: "d"}
+	id, err := hd.Save(&row)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if id != int64(12) || row.Code != 12 {
+		t.Fatal("wrong key", id, row)
+	}
+}
+
 type sqlGenModel struct {
 	Prim   Id
 	First  string
@@ -706,7 +1307,7 @@ type sqlGenModel struct {
 var sqlGenSampleData = &sqlGenModel{3, "FirstName", "LastName", 6}
 
 func TestInsertSQL(t *testing.T) {
-	for _, info := range toRun {
+	for _, info := range allDialectInfos {
 		DoTestInsertSQL(t, info)
 	}
 }
@@ -723,7 +1324,7 @@ func DoTestInsertSQL(t *testing.T, info dialectInfo) {
 }
 
 func TestUpdateSQL(t *testing.T) {
-	for _, info := range toRun {
+	for _, info := range allDialectInfos {
 		DoTestUpdateSQL(t, info)
 	}
 }
@@ -740,7 +1341,7 @@ func DoTestUpdateSQL(t *testing.T, info dialectInfo) {
 }
 
 func TestDeleteSQL(t *testing.T) {
-	for _, info := range toRun {
+	for _, info := range allDialectInfos {
 		DoTestDeleteSQL(t, info)
 	}
 }
@@ -757,17 +1358,20 @@ func DoTestDeleteSQL(t *testing.T, info dialectInfo) {
 }
 
 func TestDeleteFromSQL(t *testing.T) {
-	for _, info := range toRun {
+	for _, info := range allDialectInfos {
 		DoTestDeleteFromSQL(t, info)
 	}
 }
 
 func DoTestDeleteFromSQL(t *testing.T, info dialectInfo) {
 	t.Logf("Dialect %T\n", info.dialect)
-	hd := info.setupDbFunc(t)
-	hd.Where("a", "=", 2).And("b", ">", 3).Or("c", "<", 4)
+	hd := New(nil, info.dialect)
+	q := hd.Where("a", "=", 2).And("b", ">", 3).Or("c", "<", 4)
 
-	sql, args := info.dialect.DeleteFromSql(hd, "sql_del_from")
+	sql, args, err := info.dialect.DeleteFromSql(q, "sql_del_from")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
 	if x := info.deleteFromSql; x != sql {
 		t.Log(sql)
 		t.Log(x)
@@ -777,10 +1381,13 @@ func DoTestDeleteFromSQL(t *testing.T, info dialectInfo) {
 		t.Log(args)
 		t.Fatal("invalid args")
 	}
+	if _, _, err := info.dialect.DeleteFromSql(hd.Limit(1), "sql_del_from"); err != ErrNoWhereClause {
+		t.Fatal("wrong error", err)
+	}
 }
 
 func TestQuerySQL(t *testing.T) {
-	for _, info := range toRun {
+	for _, info := range allDialectInfos {
 		DoTestQuerySQL(t, info)
 	}
 }
@@ -788,55 +1395,390 @@ func TestQuerySQL(t *testing.T) {
 func DoTestQuerySQL(t *testing.T, info dialectInfo) {
 	t.Logf("Dialect %T\n", info.dialect)
 	hood := New(nil, info.dialect)
-	hood.Select(&sqlGenModel{})
-	query, _ := hood.Dialect.QuerySql(hood)
+	query, _ := hood.Dialect.QuerySql(hood.Select(&sqlGenModel{}))
 	if x := info.wcQuerySql; x != query {
 		t.Log(query)
 		t.Log(x)
 		t.Fatal("invalid query", query, x)
 	}
 
-	hood = New(nil, info.dialect)
-	hood.Select(&sqlGenModel{}, "col1", "col2")
-	hood.Where("user.id", "=", Path("order.id"))
-	hood.And("a", ">", 4)
-	hood.Or("b", "<", 5)
-	hood.And("c", "=", 6)
-	hood.Or("d", "=", 7)
-	hood.Join(InnerJoin, "orders", "sql_gen_model.id1", "orders.id2")
-	hood.GroupBy("user.name")
-	hood.Having("SUM(price) < ?", 2000)
-	hood.OrderBy("user.first_name")
-	hood.Offset(3)
-	hood.Limit(10)
+	q := hood.Select(&sqlGenModel{}, "col1", "col2").
+		Where("user.id", "=", Path("order.id")).
+		And("a", ">", 4).
+		Or("b", "<", 5).
+		And("c", "=", 6).
+		Or("d", "=", 7).
+		Join(InnerJoin, "orders", "sql_gen_model.id1", "orders.id2").
+		GroupBy("user.name").
+		Having("SUM(price) < ?", 2000).
+		OrderBy("user.first_name").
+		Offset(3).
+		Limit(10)
 
-	hoodDesc := hood.Copy()
-	hoodAsc := hood.Copy()
+	// the queries are derived from q and must not modify it
+	qDesc := q.Desc()
+	qAsc := q.Asc()
 
 	// TODO: verify 2nd argument ARGS
 	// Without ASC/DESC
-	query, _ = hood.Dialect.QuerySql(hood)
+	query, _ = hood.Dialect.QuerySql(q)
 	if x := info.querySql; x != query {
 		t.Fatalf("invalid query:\n%s\n---should be---\n%s\n", x, query)
 	}
 
 	// With DESC
-	hoodDesc.Desc()
-	query, _ = hoodDesc.Dialect.QuerySql(hoodDesc)
+	query, _ = hood.Dialect.QuerySql(qDesc)
 	if x := info.querySqlDesc; x != query {
 		t.Fatalf("invalid query:\n%s\n---should be---\n%s\n", x, query)
 	}
 
 	// With ASC
-	hoodAsc.Asc()
-	query, _ = hoodAsc.Dialect.QuerySql(hoodAsc)
+	query, _ = hood.Dialect.QuerySql(qAsc)
 	if x := info.querySqlAsc; x != query {
 		t.Fatalf("invalid query:\n%s\n---should be---\n%s\n", x, query)
 	}
 }
 
-func TestDropTableSQL(t *testing.T) {
+func TestGroupedQuerySQL(t *testing.T) {
+	for _, info := range allDialectInfos {
+		DoTestGroupedQuerySQL(t, info)
+	}
+}
+
+func DoTestGroupedQuerySQL(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hood := New(nil, info.dialect)
+	q := hood.Select("users").
+		Where("a", "=", 1).
+		AndGroup(func(c *Cond) {
+			c.Where("b", "=", 2).OrGroup(func(c *Cond) {
+				c.Where("c", "=", 3).And("d", "=", 4)
+			})
+		}).
+		OrGroup(func(c *Cond) {}).
+		Or("e", "=", 5)
+	query, args := hood.Dialect.QuerySql(q)
+	if x := info.groupedQuerySql; x != query {
+		t.Fatalf("invalid query:\n%s\n---should be---\n%s\n", query, x)
+	}
+	if x := len(args); x != 5 {
+		t.Fatal("wrong arg count", x)
+	}
+	for i, v := range args {
+		if v != i+1 {
+			t.Fatal("wrong arg", i, v)
+		}
+	}
+}
+
+func TestOperatorQuerySQL(t *testing.T) {
+	for _, info := range allDialectInfos {
+		DoTestOperatorQuerySQL(t, info)
+	}
+}
+
+func DoTestOperatorQuerySQL(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hood := New(nil, info.dialect)
+	q := hood.Select("users").
+		Where("id", "in", []int{1, 2, 3}).
+		And("name", "NOT IN", []string{}).
+		And("deleted", "IS NULL", nil).
+		And("age", "BETWEEN", [2]int{18, 65}).
+		Or("name", "like", "a%")
+	if err := q.err; err != nil {
+		t.Fatal("error not nil", err)
+	}
+	query, args := hood.Dialect.QuerySql(q)
+	if x := info.operatorQuerySql; x != query {
+		t.Fatalf("invalid query:\n%s\n---should be---\n%s\n", query, x)
+	}
+	if x := len(args); x != 6 {
+		t.Fatal("wrong arg count", x)
+	}
+	if args[0] != 1 || args[2] != 3 || args[3] != 18 || args[4] != 65 || args[5] != "a%" {
+		t.Fatal("wrong args", args)
+	}
+}
+
+func TestAggregateQuerySQL(t *testing.T) {
+	for _, info := range allDialectInfos {
+		DoTestAggregateQuerySQL(t, info)
+	}
+}
+
+func DoTestAggregateQuerySQL(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hood := New(nil, info.dialect)
+	q := hood.Join(InnerJoin, "users", "orders.user_id", "users.id").
+		Where("users.name", "=", "Bob").
+		GroupBy("users.name")
+	query, args := q.aggregateSql("orders", "SUM", "orders.price")
+	if x := info.aggregateQuerySql; x != query {
+		t.Fatalf("invalid query:\n%s\n---should be---\n%s\n", query, x)
+	}
+	if x := len(args); x != 1 {
+		t.Fatal("wrong arg count", x)
+	}
+	query, args = q.OrderBy("users.name").Limit(10).Offset(20).aggregateSql("orders", "SUM", "orders.price")
+	if x := info.aggregateQuerySql; x != query || len(args) != 1 {
+		t.Fatalf("paginated query not aggregated:\n%s\n---should be---\n%s\n", query, x)
+	}
+}
+
+func TestAggregates(t *testing.T) {
 	for _, info := range toRun {
+		DoTestAggregates(t, info)
+	}
+}
+
+func DoTestAggregates(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hd := info.setupDbFunc(t)
+
+	type aggregateModel struct {
+		Id    Id
+		Name  string
+		Price int
+	}
+
+	hd.DropTable(&aggregateModel{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&aggregateModel{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	n, err := hd.Count(&aggregateModel{})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if n != 0 {
+		t.Fatal("wrong count", n)
+	}
+	sum, err := hd.Sum(&aggregateModel{}, "price")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if sum != 0 {
+		t.Fatal("wrong sum", sum)
+	}
+	models := []aggregateModel{
+		{Name: "a", Price: 1},
+		{Name: "b", Price: 2},
+		{Name: "c", Price: 6},
+	}
+	_, err = hd.SaveAll(&models)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	n, err = hd.Where("price", ">", 1).Count(&aggregateModel{})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if n != 2 {
+		t.Fatal("wrong count", n)
+	}
+	n, err = hd.OrderBy("name").Limit(1).Offset(1).Count(&aggregateModel{})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if n != 3 {
+		t.Fatal("wrong count of paginated query", n)
+	}
+	sum, err = hd.Sum(&aggregateModel{}, "price")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if sum != 9 {
+		t.Fatal("wrong sum", sum)
+	}
+	avg, err := hd.Where("price", "<", 6).Avg(&aggregateModel{}, "price")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if avg != 1.5 {
+		t.Fatal("wrong avg", avg)
+	}
+	var min int
+	err = hd.Min(&aggregateModel{}, "price", &min)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if min != 1 {
+		t.Fatal("wrong min", min)
+	}
+	var max string
+	err = hd.Max(&aggregateModel{}, "name", &max)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if max != "c" {
+		t.Fatal("wrong max", max)
+	}
+	_, err = hd.Where("price", "INVALID", 1).Count(&aggregateModel{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSavepointSQL(t *testing.T) {
+	for _, info := range allDialectInfos {
+		DoTestSavepointSQL(t, info)
+	}
+}
+
+func DoTestSavepointSQL(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	if x := info.dialect.SavepointSql("sp"); x != info.savepointSql {
+		t.Fatal("wrong sql", x)
+	}
+	if x := info.dialect.ReleaseSavepointSql("sp"); x != info.releaseSavepointSql {
+		t.Fatal("wrong sql", x)
+	}
+	if x := info.dialect.RollbackToSavepointSql("sp"); x != info.rollbackToSavepointSql {
+		t.Fatal("wrong sql", x)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		dialect   Dialect
+		err       error
+		retryable bool
+	}{
+		{NewPostgres(), &pq.Error{Code: "40001"}, true},
+		{NewPostgres(), &pq.Error{Code: "40P01"}, true},
+		{NewPostgres(), &pq.Error{Code: "23505"}, false},
+		{NewMysql(), &mymysqldrv.Error{Code: 1213, Msg: []byte("Deadlock found")}, true},
+		{NewMysql(), &mymysqldrv.Error{Code: 1062, Msg: []byte("Duplicate entry")}, false},
+		{NewMysql(), mymysqldrv.Error{Code: 1213, Msg: []byte("Deadlock found")}, true},
+		{NewMysql(), fmt.Errorf("saving: %w", &mymysqldrv.Error{Code: 1213, Msg: []byte("Deadlock found")}), true},
+		{NewGoMysql(), &gomysqldrv.MySQLError{Number: 1213, Message: "Deadlock found"}, true},
+		{NewGoMysql(), &gomysqldrv.MySQLError{Number: 1062, Message: "Duplicate entry"}, false},
+		{NewGoMysql(), fmt.Errorf("saving: %w", &gomysqldrv.MySQLError{Number: 1213, Message: "Deadlock found"}), true},
+		{NewPostgres(), fmt.Errorf("saving: %w", &pq.Error{Code: "40P01"}), true},
+		{NewMssql(), mssqldrv.Error{Number: 1205}, true},
+		{NewMssql(), mssqldrv.Error{Number: 2627}, false},
+		{NewSqlite3(), errors.New("database is locked"), false},
+	}
+	for _, test := range tests {
+		if x := test.dialect.IsRetryable(test.err); x != test.retryable {
+			t.Fatalf("%T: wrong result %v for %v", test.dialect, x, test.err)
+		}
+		if test.dialect.IsRetryable(nil) {
+			t.Fatalf("%T: nil error should not be retryable", test.dialect)
+		}
+	}
+}
+
+func TestConvertError(t *testing.T) {
+	tests := []struct {
+		dialect Dialect
+		err     error
+		want    error
+	}{
+		{
+			NewPostgres(),
+			&pq.Error{Code: "23505", Table: "users", Constraint: "email_index", Detail: "Key (email)=(a@b.c) already exists."},
+			&UniqueViolationError{ConstraintViolation{Table: "users", Column: "email", Constraint: "email_index"}},
+		},
+		{
+			NewPostgres(),
+			&pq.Error{Code: "23503", Table: "posts", Constraint: "posts_user_id_fkey", Detail: `Key (user_id)=(5) is not present in table "users".`},
+			&ForeignKeyViolationError{ConstraintViolation{Table: "posts", Column: "user_id", Constraint: "posts_user_id_fkey"}},
+		},
+		{
+			NewPostgres(),
+			&pq.Error{Code: "23502", Table: "users", Column: "name"},
+			&NotNullViolationError{ConstraintViolation{Table: "users", Column: "name"}},
+		},
+		{
+			NewPostgres(),
+			&pq.Error{Code: "23514", Table: "users", Constraint: "age_check"},
+			&CheckViolationError{ConstraintViolation{Table: "users", Constraint: "age_check"}},
+		},
+		{
+			NewMysql(),
+			&mymysqldrv.Error{Code: 1062, Msg: []byte("Duplicate entry 'a@b.c' for key 'users.email_index'")},
+			&UniqueViolationError{ConstraintViolation{Table: "users", Constraint: "email_index"}},
+		},
+		{
+			NewMysql(),
+			&mymysqldrv.Error{Code: 1452, Msg: []byte("Cannot add or update a child row: a foreign key constraint fails (`db`.`posts`, CONSTRAINT `posts_ibfk_1` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`))")},
+			&ForeignKeyViolationError{ConstraintViolation{Table: "posts", Column: "user_id", Constraint: "posts_ibfk_1"}},
+		},
+		{
+			NewGoMysql(),
+			&gomysqldrv.MySQLError{Number: 1048, SQLState: [5]byte{'2', '3', '0', '0', '0'}, Message: "Column 'name' cannot be null"},
+			&NotNullViolationError{ConstraintViolation{Column: "name"}},
+		},
+		{
+			NewGoMysql(),
+			&gomysqldrv.MySQLError{Number: 3819, Message: "Check constraint 'age_check' is violated."},
+			&CheckViolationError{ConstraintViolation{Constraint: "age_check"}},
+		},
+		{
+			NewMssql(),
+			mssqldrv.Error{Number: 2601, Message: "Cannot insert duplicate key row in object 'dbo.users' with unique index 'email_index'. The duplicate key value is (a@b.c)."},
+			&UniqueViolationError{ConstraintViolation{Table: "users", Constraint: "email_index"}},
+		},
+		{
+			NewMssql(),
+			mssqldrv.Error{Number: 547, Message: `The INSERT statement conflicted with the CHECK constraint "age_check". The conflict occurred in database "db", table "dbo.users", column 'age'.`},
+			&CheckViolationError{ConstraintViolation{Table: "users", Column: "age", Constraint: "age_check"}},
+		},
+		{
+			NewMssql(),
+			mssqldrv.Error{Number: 515, Message: "Cannot insert the value NULL into column 'name', table 'db.dbo.users'; column does not allow nulls. INSERT fails."},
+			&NotNullViolationError{ConstraintViolation{Table: "users", Column: "name"}},
+		},
+		{
+			NewSqlite3(),
+			errors.New("UNIQUE constraint failed: users.first, users.last"),
+			&UniqueViolationError{ConstraintViolation{Table: "users", Column: "first, last"}},
+		},
+		{
+			NewSqlite3(),
+			errors.New("FOREIGN KEY constraint failed"),
+			&ForeignKeyViolationError{},
+		},
+		{
+			NewSqlite3(),
+			errors.New("database is locked"),
+			nil,
+		},
+	}
+	for _, test := range tests {
+		err := test.dialect.ConvertError(test.err)
+		if test.want == nil {
+			if err != test.err {
+				t.Fatalf("%T: error should be unchanged, got %v", test.dialect, err)
+			}
+			continue
+		}
+		if reflect.TypeOf(err) != reflect.TypeOf(test.want) {
+			t.Fatalf("%T: wrong error type %T for %v", test.dialect, err, test.err)
+		}
+		want := reflect.ValueOf(test.want).Elem().Field(0).Interface().(ConstraintViolation)
+		want.Err = test.err
+		if x := reflect.ValueOf(err).Elem().Field(0).Interface(); !reflect.DeepEqual(x, want) {
+			t.Fatalf("%T: wrong violation %+v", test.dialect, x)
+		}
+		if !reflect.DeepEqual(errors.Unwrap(err), test.err) {
+			t.Fatalf("%T: should wrap the driver error", test.dialect)
+		}
+		if test.dialect.ConvertError(nil) != nil {
+			t.Fatalf("%T: nil error should stay nil", test.dialect)
+		}
+		if x := test.dialect.ConvertError(err); x != err {
+			t.Fatalf("%T: converted error wrapped again %v", test.dialect, x)
+		}
+	}
+}
+
+func TestDropTableSQL(t *testing.T) {
+	for _, info := range allDialectInfos {
 		DoTestDropTableSQL(t, info)
 	}
 }
@@ -852,7 +1794,7 @@ func DoTestDropTableSQL(t *testing.T, info dialectInfo) {
 }
 
 func TestRenameTableSQL(t *testing.T) {
-	for _, info := range toRun {
+	for _, info := range allDialectInfos {
 		DoTestRenameTableSQL(t, info)
 	}
 }
@@ -865,20 +1807,20 @@ func DoTestRenameTableSQL(t *testing.T, info dialectInfo) {
 }
 
 func TestAddColumSQL(t *testing.T) {
-	for _, info := range toRun {
+	for _, info := range allDialectInfos {
 		DoTestAddColumSQL(t, info)
 	}
 }
 
 func DoTestAddColumSQL(t *testing.T, info dialectInfo) {
 	t.Logf("Dialect %T\n", info.dialect)
-	if x := info.dialect.AddColumnSql("a", "c", "", 100); x != info.addColumnSql {
+	if x, _ := info.dialect.AddColumnSql("a", "c", "", 100, nil); x != info.addColumnSql {
 		t.Fatal("wrong sql", x)
 	}
 }
 
 func TestRenameColumnSql(t *testing.T) {
-	for _, info := range toRun {
+	for _, info := range allDialectInfos {
 		DoTestRenameColumnSql(t, info)
 	}
 }
@@ -891,20 +1833,25 @@ func DoTestRenameColumnSql(t *testing.T, info dialectInfo) {
 }
 
 func TestChangeColumnSql(t *testing.T) {
-	for _, info := range toRun {
+	for _, info := range allDialectInfos {
 		DoTestChangeColumnSql(t, info)
 	}
 }
 
 func DoTestChangeColumnSql(t *testing.T, info dialectInfo) {
 	t.Logf("Dialect %T\n", info.dialect)
-	if x := info.dialect.ChangeColumnSql("a", "b", "", 100); x != info.changeColumnSql {
+	x, err := info.dialect.ChangeColumnSql("a", "b", "", 100)
+	if x != info.changeColumnSql {
 		t.Fatal("wrong sql", x)
 	}
+	// an empty expectation marks dialects without a single statement
+	if (err != nil) != (x == "") {
+		t.Fatal("wrong error", err)
+	}
 }
 
 func TestRemoveColumnSql(t *testing.T) {
-	for _, info := range toRun {
+	for _, info := range allDialectInfos {
 		DoTestRemoveColumnSql(t, info)
 	}
 }
@@ -917,7 +1864,7 @@ func DoTestRemoveColumnSql(t *testing.T, info dialectInfo) {
 }
 
 func TestCreateIndexSql(t *testing.T) {
-	for _, info := range toRun {
+	for _, info := range allDialectInfos {
 		DoTestCreateIndexSql(t, info)
 	}
 }
@@ -933,7 +1880,7 @@ func DoTestCreateIndexSql(t *testing.T, info dialectInfo) {
 }
 
 func TestDropIndexSql(t *testing.T) {
-	for _, info := range toRun {
+	for _, info := range allDialectInfos {
 		DoTestDropIndexSql(t, info)
 	}
 }
@@ -962,7 +1909,7 @@ func DoTestNullValues(t *testing.T, info dialectInfo) {
 	if err != nil {
 		t.Fatal(err.Error())
 	}
-	tx := hd.Begin()
+	tx := mustBegin(t, hd)
 	tx.CreateTable(&nullModel{})
 	err = tx.Commit()
 	if err != nil {
@@ -997,14 +1944,14 @@ func DoTestCommitLastError(t *testing.T, info dialectInfo) {
 		Id Id
 	}
 	hd := info.setupDbFunc(t)
-	tx := hd.Begin()
+	tx := mustBegin(t, hd)
 	if !tx.IsTransaction() {
 		t.Fatal("should be a transaction")
 	}
 	tx.CreateTable(&commitClash{})
 	tx.CreateTable(&commitClash{})
 	err := tx.Commit()
-	if tx.firstTxError == nil {
+	if tx.firstError() == nil {
 		t.Fatal("tx error should be set")
 	}
 	if err == nil {
@@ -1012,78 +1959,1419 @@ func DoTestCommitLastError(t *testing.T, info dialectInfo) {
 	}
 }
 
+// money is a custom field type stored as cents.
+type money struct {
+	cents int64
+}
+
+func (m money) SqlType(size int) string {
+	return "bigint"
+}
+
+func (m money) Value() (driver.Value, error) {
+	return m.cents, nil
+}
+
+func (m *money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case int64:
+		m.cents = v
+	case nil:
+		m.cents = 0
+	default:
+		return fmt.Errorf("cannot scan %T into money", src)
+	}
+	return nil
+}
+
+type email string
+
+func TestCustomSqlType(t *testing.T) {
+	for _, info := range allDialectInfos {
+		if x, err := info.dialect.SqlType(money{}, 0); err != nil || x != "bigint" {
+			t.Fatal("wrong type", x, err)
+		}
+		want, _ := info.dialect.SqlType("", 128)
+		if x, err := info.dialect.SqlType(email(""), 128); err != nil || x != want {
+			t.Fatal("wrong type", x, err)
+		}
+		want, _ = info.dialect.SqlType([]byte{}, 0)
+		if x, err := info.dialect.SqlType(json.RawMessage{}, 0); err != nil || x != want {
+			t.Fatal("wrong type", x, err)
+		}
+	}
+}
+
+func TestNullableSqlType(t *testing.T) {
+	for _, info := range allDialectInfos {
+		tests := []struct {
+			nullable interface{}
+			value    interface{}
+		}{
+			{(*string)(nil), ""},
+			{new(int64), int64(0)},
+			{(*time.Time)(nil), time.Time{}},
+			{(*money)(nil), money{}},
+			{sql.NullString{}, ""},
+			{sql.NullInt64{}, int64(0)},
+			{sql.NullBool{}, false},
+			{sql.NullFloat64{}, float64(0)},
+			{sql.NullTime{}, time.Time{}},
+		}
+		for _, test := range tests {
+			want, _ := info.dialect.SqlType(test.value, 128)
+			if x, err := info.dialect.SqlType(test.nullable, 128); err != nil || x != want {
+				t.Fatalf("%T: wrong type %v for %T %v", info.dialect, x, test.nullable, err)
+			}
+		}
+	}
+}
+
+func TestNullableFields(t *testing.T) {
+	for _, info := range toRun {
+		DoTestNullableFields(t, info)
+	}
+}
+
+func DoTestNullableFields(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hd := info.setupDbFunc(t)
+	type nullableModel struct {
+		Id    Id
+		Name  *string `sql:"size(64)"`
+		Age   sql.NullInt64
+		Born  *time.Time
+		Price *money
+	}
+
+	hd.DropTable(&nullableModel{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&nullableModel{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+
+	name := "banana"
+	born := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	models := []nullableModel{
+		{},
+		{Name: &name, Age: sql.NullInt64{Int64: 0, Valid: true}, Born: &born, Price: &money{5}},
+	}
+	_, err = hd.SaveAll(&models)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	var out []nullableModel
+	err = hd.OrderBy("id").Find(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(out) != 2 {
+		t.Fatal("wrong row count", len(out))
+	}
+	if x := out[0]; x.Name != nil || x.Age.Valid || x.Born != nil || x.Price != nil {
+		t.Fatal("NULL not preserved", x)
+	}
+	x := out[1]
+	if x.Name == nil || *x.Name != name {
+		t.Fatal("wrong name", x.Name)
+	}
+	if !x.Age.Valid || x.Age.Int64 != 0 {
+		t.Fatal("wrong age", x.Age)
+	}
+	if x.Born == nil || !x.Born.Equal(born) {
+		t.Fatal("wrong born", x.Born)
+	}
+	if x.Price == nil || x.Price.cents != 5 {
+		t.Fatal("wrong price", x.Price)
+	}
+
+	// update to NULL
+	x.Name = nil
+	_, err = hd.Save(&x)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	var names []*string
+	err = hd.FindSql(&names, "SELECT name FROM nullable_model ORDER BY id")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(names) != 2 || names[0] != nil || names[1] != nil {
+		t.Fatal("wrong names", names)
+	}
+}
+
+func TestCustomFieldType(t *testing.T) {
+	for _, info := range toRun {
+		DoTestCustomFieldType(t, info)
+	}
+}
+
+func DoTestCustomFieldType(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hd := info.setupDbFunc(t)
+	type customTypeModel struct {
+		Id    Id
+		Price money
+		Email email `sql:"size(128)"`
+	}
+
+	hd.DropTable(&customTypeModel{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&customTypeModel{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+
+	_, err = hd.Save(&customTypeModel{Price: money{1250}, Email: "a@b.c"})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	var out customTypeModel
+	err = hd.First(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if out.Price.cents != 1250 || out.Email != "a@b.c" {
+		t.Fatal("wrong values", out)
+	}
+	var prices []money
+	err = hd.FindSql(&prices, "SELECT price FROM custom_type_model")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(prices) != 1 || prices[0].cents != 1250 {
+		t.Fatal("wrong prices", prices)
+	}
+}
+
+func TestUnsupportedSqlType(t *testing.T) {
+	type unsupported struct {
+		Id   Id
+		Tags map[string]string
+	}
+	model, _ := interfaceToModel(&unsupported{})
+	for _, info := range allDialectInfos {
+		_, err := info.dialect.SqlType(map[string]string{}, 0)
+		if e, ok := err.(*UnsupportedTypeError); !ok || e.Type != reflect.TypeOf(map[string]string{}) {
+			t.Fatal("wrong error", err)
+		}
+		if _, err := info.dialect.CreateTableSql(model, false); err == nil {
+			t.Fatal("should fail on unsupported type")
+		}
+		if _, err := info.dialect.AddColumnSql("a", "b", struct{}{}, 0, nil); err == nil {
+			t.Fatal("should fail on unsupported type")
+		}
+		if _, err := info.dialect.ChangeColumnSql("a", "b", struct{}{}, 0); err == nil {
+			t.Fatal("should fail on unsupported type")
+		}
+	}
+}
+
 func TestSqlTypeForPgDialect(t *testing.T) {
 	d := NewPostgres()
-	if x := d.SqlType(true, 0); x != "boolean" {
+	if x, _ := d.SqlType(true, 0); x != "boolean" {
 		t.Fatal("wrong type", x)
 	}
 	var indirect interface{} = true
-	if x := d.SqlType(indirect, 0); x != "boolean" {
+	if x, _ := d.SqlType(indirect, 0); x != "boolean" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType(uint32(2), 0); x != "integer" {
+	if x, _ := d.SqlType(uint32(2), 0); x != "integer" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType(Id(1), 0); x != "bigserial" {
+	if x, _ := d.SqlType(Id(1), 0); x != "bigserial" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType(int64(1), 0); x != "bigint" {
+	if x, _ := d.SqlType(int64(1), 0); x != "bigint" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType(1.8, 0); x != "double precision" {
+	if x, _ := d.SqlType(1.8, 0); x != "double precision" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType([]byte("asdf"), 0); x != "bytea" {
+	if x, _ := d.SqlType([]byte("asdf"), 0); x != "bytea" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType("astring", 0); x != "text" {
+	if x, _ := d.SqlType("astring", 0); x != "text" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType("a", 255); x != "varchar(255)" {
+	if x, _ := d.SqlType("a", 255); x != "varchar(255)" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType("b", 128); x != "varchar(128)" {
+	if x, _ := d.SqlType("b", 128); x != "varchar(128)" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType(time.Now(), 0); x != "timestamp with time zone" {
+	if x, _ := d.SqlType(time.Now(), 0); x != "timestamp with time zone" {
 		t.Fatal("wrong type", x)
 	}
 }
 
 func TestSqlTypeForMysqlDialect(t *testing.T) {
 	d := NewMysql()
-	if x := d.SqlType(true, 0); x != "boolean" {
+	if x, _ := d.SqlType(true, 0); x != "boolean" {
 		t.Fatal("wrong type", x)
 	}
 	var indirect interface{} = true
-	if x := d.SqlType(indirect, 0); x != "boolean" {
+	if x, _ := d.SqlType(indirect, 0); x != "boolean" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType(uint32(2), 0); x != "int" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType(Id(1), 0); x != "bigint" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType(uint32(2), 0); x != "int" {
+	if x, _ := d.SqlType(int64(1), 0); x != "bigint" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType(Id(1), 0); x != "bigint" {
+	if x, _ := d.SqlType(1.8, 0); x != "double" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType(int64(1), 0); x != "bigint" {
+	if x, _ := d.SqlType([]byte("asdf"), 0); x != "longblob" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType(1.8, 0); x != "double" {
+	if x, _ := d.SqlType("astring", 0); x != "longtext" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType([]byte("asdf"), 0); x != "longblob" {
+	if x, _ := d.SqlType("a", 65536); x != "longtext" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType("astring", 0); x != "longtext" {
+	if x, _ := d.SqlType("b", 128); x != "varchar(128)" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType("a", 65536); x != "longtext" {
+	if x, _ := d.SqlType(time.Now(), 0); x != "timestamp" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType("b", 128); x != "varchar(128)" {
+}
+
+func TestSqlTypeForSqlite3Dialect(t *testing.T) {
+	d := NewSqlite3()
+	if x, _ := d.SqlType(true, 0); x != "boolean" {
+		t.Fatal("wrong type", x)
+	}
+	var indirect interface{} = true
+	if x, _ := d.SqlType(indirect, 0); x != "boolean" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType(uint32(2), 0); x != "integer" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType(Id(1), 0); x != "integer" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType(int64(1), 0); x != "integer" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType(1.8, 0); x != "real" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType([]byte("asdf"), 0); x != "blob" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType("astring", 0); x != "text" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType("b", 128); x != "varchar(128)" {
 		t.Fatal("wrong type", x)
 	}
-	if x := d.SqlType(time.Now(), 0); x != "timestamp" {
+	if x, _ := d.SqlType(time.Now(), 0); x != "datetime" {
 		t.Fatal("wrong type", x)
 	}
 }
+
+func TestSqlite3SetModelValue(t *testing.T) {
+	d := NewSqlite3()
+	type model struct {
+		A bool
+		B string
+		C time.Time
+		D Created
+		E Updated
+	}
+	var m model
+	v := reflect.ValueOf(&m).Elem()
+	set := func(field string, driverValue interface{}) {
+		err := d.SetModelValue(reflect.ValueOf(&driverValue).Elem(), v.FieldByName(field))
+		if err != nil {
+			t.Fatal("error not nil", err)
+		}
+	}
+	set("A", int64(1))
+	if !m.A {
+		t.Fatal("wrong value", m.A)
+	}
+	set("B", "banana")
+	if x := m.B; x != "banana" {
+		t.Fatal("wrong value", x)
+	}
+	set("C", "2013-01-02 03:04:05")
+	if x := m.C; !x.Equal(time.Date(2013, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatal("wrong value", x)
+	}
+	set("D", int64(1357095845))
+	if x := m.D; x.Unix() != 1357095845 {
+		t.Fatal("wrong value", x)
+	}
+	set("E", []byte("2013-01-02T03:04:05+01:00"))
+	if x := m.E; x.Unix() != 1357092245 {
+		t.Fatal("wrong value", x)
+	}
+}
+
+func TestSqlite3TableRebuild(t *testing.T) {
+	for _, info := range toRun {
+		if _, ok := info.dialect.(*sqlite3); ok {
+			DoTestSqlite3TableRebuild(t, info)
+		}
+	}
+}
+
+func TestSqlite3InsertAllRowid(t *testing.T) {
+	for _, info := range toRun {
+		if _, ok := info.dialect.(*sqlite3); ok {
+			DoTestSqlite3InsertAllRowid(t, info)
+		}
+	}
+}
+
+func DoTestSqlite3InsertAllRowid(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	type rowidModel struct {
+		Id   Id
+		Name string
+	}
+	hd := info.setupDbFunc(t)
+	hd.DropTableIfExists(&rowidModel{})
+	// without AUTOINCREMENT, rows get random ids once the largest rowid is used
+	_, err := hd.Exec(`CREATE TABLE "rowid_model" ("id" integer PRIMARY KEY, "name" text)`)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	_, err = hd.Exec(`INSERT INTO "rowid_model" ("id", "name") VALUES (9223372036854775807, 'max')`)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	rows := []rowidModel{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	ids, err := hd.InsertAll(&rows)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	for i, row := range rows {
+		var found []rowidModel
+		err := hd.Where("id", "=", row.Id).Find(&found)
+		if err != nil {
+			t.Fatal("error not nil", err)
+		}
+		if len(found) != 1 || found[0].Name != row.Name || ids[i] != row.Id {
+			t.Fatal("wrong id", i, ids[i], found)
+		}
+	}
+}
+
+func TestSqlite3RebuildReferencedTable(t *testing.T) {
+	for _, info := range toRun {
+		if _, ok := info.dialect.(*sqlite3); ok {
+			DoTestSqlite3RebuildReferencedTable(t, info)
+		}
+	}
+}
+
+func DoTestSqlite3RebuildReferencedTable(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	type rebuildParent struct {
+		Id   Id
+		Name string
+	}
+	type rebuildParentName struct {
+		Name string `sql:"size(64)"`
+	}
+	type rebuildChild struct {
+		Id              Id
+		RebuildParentId int64 `sql:"references(rebuild_parent.id),ondelete(cascade)"`
+	}
+	hd := info.setupDbFunc(t)
+	// reuse the connection the rebuild ran on, to test the restored setting
+	hd.Db.SetMaxOpenConns(1)
+	hd.DropTableIfExists(&rebuildChild{})
+	hd.DropTableIfExists(&rebuildParent{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&rebuildParent{})
+	tx.CreateTable(&rebuildChild{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	parent := rebuildParent{Name: "a"}
+	_, err = hd.Save(&parent)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	_, err = hd.Save(&rebuildChild{RebuildParentId: int64(parent.Id)})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+
+	// foreign keys can't be disabled inside a transaction
+	tx = mustBegin(t, hd)
+	err = tx.ChangeColumns(&rebuildParent{}, &rebuildParentName{})
+	if err == nil || !strings.Contains(err.Error(), "rebuild_child") {
+		t.Fatal("wrong error", err)
+	}
+	tx.Rollback()
+	if n, _ := hd.Count(&rebuildChild{}); n != 1 {
+		t.Fatal("child rows deleted", n)
+	}
+
+	// outside of a transaction they are disabled during the rebuild
+	d := info.dialect.(*sqlite3)
+	err = d.rebuildTable(hd, "rebuild_parent", nil, nil)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if n, _ := hd.Count(&rebuildChild{}); n != 1 {
+		t.Fatal("child rows deleted", n)
+	}
+	var enabled bool
+	err = hd.QueryRow("PRAGMA foreign_keys").Scan(&enabled)
+	if err != nil || !enabled {
+		t.Fatal("foreign keys not enabled again", err)
+	}
+	_, err = hd.Delete(&parent)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if n, _ := hd.Count(&rebuildChild{}); n != 0 {
+		t.Fatal("delete not cascaded", n)
+	}
+}
+
+func DoTestSqlite3TableRebuild(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	type rebuildModel struct {
+		Id Id
+		A  int
+		B  string `sql:"notnull,default('b')"`
+		C  string
+	}
+	hd := info.setupDbFunc(t)
+	hd.DropTableIfExists(&rebuildModel{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&rebuildModel{})
+	tx.CreateIndex(&rebuildModel{}, "rebuild_model_b_index", true, "b")
+	tx.CreateIndex(&rebuildModel{}, "rebuild_model_c_index", false, "c")
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	_, err = hd.Save(&rebuildModel{A: 5, B: "x", C: "y"})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+
+	d := info.dialect.(*sqlite3)
+	tx = mustBegin(t, hd)
+	d.rebuildTable(tx, "rebuild_model", func(columns []*sqlite3Column) []*sqlite3Column {
+		kept := []*sqlite3Column{}
+		for _, c := range columns {
+			switch c.name {
+			case "a":
+				c.typ = "text"
+			case "b":
+				c.name = "d"
+			}
+			if c.name != "c" {
+				kept = append(kept, c)
+			}
+		}
+		return kept
+	}, nil)
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+
+	var out []struct {
+		Id Id
+		A  string
+		D  string
+	}
+	err = hd.Select("rebuild_model").Find(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x := len(out); x != 1 {
+		t.Fatal("wrong length", x)
+	}
+	if x := out[0]; x.Id != 1 || x.A != "5" || x.D != "x" {
+		t.Fatal("wrong value", x)
+	}
+	indexes, err := d.tableIndexes(hd, "rebuild_model")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x := len(indexes); x != 1 {
+		t.Fatal("wrong index count", x)
+	}
+	if x := indexes[0]; x.Name != "rebuild_model_b_index" || !x.Unique || x.Columns[0] != "d" {
+		t.Fatal("wrong index", x)
+	}
+}
+
+func TestGoMysqlSetModelValue(t *testing.T) {
+	d := NewGoMysql()
+	type model struct {
+		A bool
+		B bool
+		C int
+		D uint
+		E float64
+		F string
+		G []byte
+		H time.Time
+		I Created
+		J Updated
+	}
+	var m model
+	v := reflect.ValueOf(&m).Elem()
+	set := func(field string, driverValue interface{}) {
+		err := d.SetModelValue(reflect.ValueOf(&driverValue).Elem(), v.FieldByName(field))
+		if err != nil {
+			t.Fatal("error not nil", err)
+		}
+	}
+	set("A", uint8(1))
+	if !m.A {
+		t.Fatal("wrong value", m.A)
+	}
+	set("B", []byte("1"))
+	if !m.B {
+		t.Fatal("wrong value", m.B)
+	}
+	set("C", []byte("-5"))
+	if x := m.C; x != -5 {
+		t.Fatal("wrong value", x)
+	}
+	set("C", uint64(6))
+	if x := m.C; x != 6 {
+		t.Fatal("wrong value", x)
+	}
+	set("D", []byte("7"))
+	if x := m.D; x != 7 {
+		t.Fatal("wrong value", x)
+	}
+	set("E", []byte("1.5"))
+	if x := m.E; x != 1.5 {
+		t.Fatal("wrong value", x)
+	}
+	set("F", []byte("banana"))
+	if x := m.F; x != "banana" {
+		t.Fatal("wrong value", x)
+	}
+	set("G", []byte("bytes!"))
+	if x := m.G; string(x) != "bytes!" {
+		t.Fatal("wrong value", x)
+	}
+	set("H", []byte("2013-01-02 03:04:05"))
+	if x := m.H; !x.Equal(time.Date(2013, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatal("wrong value", x)
+	}
+	now := time.Now()
+	set("I", now)
+	if x := m.I; !x.Equal(now) {
+		t.Fatal("wrong value", x)
+	}
+	set("J", []byte("0000-00-00 00:00:00"))
+	if x := m.J; !x.IsZero() {
+		t.Fatal("wrong value", x)
+	}
+}
+
+func TestSqlTypeForMssqlDialect(t *testing.T) {
+	d := NewMssql()
+	if x, _ := d.SqlType(true, 0); x != "bit" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType(uint32(2), 0); x != "int" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType(Id(1), 0); x != "bigint" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType(int64(1), 0); x != "bigint" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType(1.8, 0); x != "float" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType([]byte("asdf"), 0); x != "varbinary(max)" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType([]byte("asdf"), 16); x != "varbinary(16)" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType("astring", 0); x != "nvarchar(max)" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType("a", 65536); x != "nvarchar(max)" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType("b", 128); x != "nvarchar(128)" {
+		t.Fatal("wrong type", x)
+	}
+	if x, _ := d.SqlType(time.Now(), 0); x != "datetime2" {
+		t.Fatal("wrong type", x)
+	}
+}
+
+func TestQuerySqlOffsetForMssqlDialect(t *testing.T) {
+	hd := New(nil, NewMssql())
+	q := hd.Select("orders").Where("a", "=", 1).Offset(5)
+	query, args := hd.Dialect.QuerySql(q)
+	if x := "SELECT * FROM [orders] WHERE [a] = @p1 ORDER BY (SELECT NULL) OFFSET @p2 ROWS"; x != query {
+		t.Fatalf("invalid query:\n%s\n---should be---\n%s\n", query, x)
+	}
+	if x := len(args); x != 2 {
+		t.Fatal("wrong arg count", x)
+	}
+}
+
+type jsonModel struct {
+	Id       Id
+	Settings map[string]string `sql:"json"`
+	Tags     []string          `sql:"json"`
+}
+
+func TestCreateTableWithJsonSql(t *testing.T) {
+	for _, info := range allDialectInfos {
+		model, err := interfaceToModel(&jsonModel{})
+		if err != nil {
+			t.Fatal("error not nil", err)
+		}
+		if x, _ := info.dialect.CreateTableSql(model, false); x != info.createTableWithJsonSql {
+			t.Fatal("wrong sql", x)
+		}
+	}
+}
+
+func TestJsonFields(t *testing.T) {
+	for _, info := range toRun {
+		DoTestJsonFields(t, info)
+	}
+}
+
+func DoTestJsonFields(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hd := info.setupDbFunc(t)
+	type address struct {
+		Street string
+		Zip    int
+	}
+	type jsonFieldsModel struct {
+		Id       Id
+		Settings map[string]string `sql:"json"`
+		Tags     []string          `sql:"json"`
+		Address  address           `sql:"json"`
+	}
+
+	hd.DropTable(&jsonFieldsModel{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&jsonFieldsModel{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+
+	models := []jsonFieldsModel{
+		{},
+		{
+			Settings: map[string]string{"theme": "dark"},
+			Tags:     []string{"a", "b"},
+			Address:  address{"Main St", 1234},
+		},
+	}
+	_, err = hd.SaveAll(&models)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	var out []jsonFieldsModel
+	err = hd.OrderBy("id").Find(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(out) != 2 {
+		t.Fatal("wrong row count", len(out))
+	}
+	if x := out[0]; x.Settings != nil || x.Tags != nil || x.Address != (address{}) {
+		t.Fatal("wrong zero values", x)
+	}
+	if x := out[1]; x.Settings["theme"] != "dark" || len(x.Tags) != 2 || x.Tags[1] != "b" || x.Address != models[1].Address {
+		t.Fatal("wrong values", x)
+	}
+	var settings []*string
+	err = hd.FindSql(&settings, "SELECT settings FROM json_fields_model ORDER BY id")
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(settings) != 2 || settings[0] != nil || settings[1] == nil {
+		t.Fatal("nil map not stored as NULL", settings)
+	}
+}
+
+type uuidModel struct {
+	Id   UUID `sql:"pk"`
+	Name string
+}
+
+func TestUUIDSql(t *testing.T) {
+	for _, info := range allDialectInfos {
+		model, err := interfaceToModel(&uuidModel{Name: "a"})
+		if err != nil {
+			t.Fatal("error not nil", err)
+		}
+		if x, _ := info.dialect.CreateTableSql(model, false); x != info.createTableWithUUIDSql {
+			t.Fatalf("%T: wrong sql %v", info.dialect, x)
+		}
+		if x, args := info.dialect.InsertSql(model); x != info.insertWithUUIDSql || len(args) != 2 {
+			t.Fatalf("%T: wrong sql %v %v", info.dialect, x, args)
+		}
+	}
+}
+
+func TestClientSidePrimaryKeys(t *testing.T) {
+	for _, info := range toRun {
+		DoTestClientSidePrimaryKeys(t, info)
+	}
+}
+
+func DoTestClientSidePrimaryKeys(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hd := info.setupDbFunc(t)
+	type uuidKeyModel struct {
+		Id   UUID `sql:"pk"`
+		Name string
+	}
+	type stringKeyModel struct {
+		Code string `sql:"pk,size(32)"`
+		Name string
+	}
+
+	hd.DropTable(&uuidKeyModel{})
+	hd.DropTable(&stringKeyModel{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&uuidKeyModel{})
+	tx.CreateTable(&stringKeyModel{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+
+	// zero UUIDs are generated on insert
+	model1 := uuidKeyModel{Name: "banana"}
+	id, err := hd.Save(&model1)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if model1.Id == (UUID{}) || id != model1.Id {
+		t.Fatal("uuid not generated", id, model1.Id)
+	}
+	model1.Name = "apple"
+	id, err = hd.Save(&model1)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if id != model1.Id {
+		t.Fatal("wrong id", id)
+	}
+	var out []uuidKeyModel
+	err = hd.Find(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(out) != 1 || out[0] != model1 {
+		t.Fatal("wrong rows", out)
+	}
+
+	// set string keys insert a new row, or update the existing one
+	model2 := stringKeyModel{Code: "a1", Name: "banana"}
+	id, err = hd.Save(&model2)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if id != "a1" {
+		t.Fatal("wrong id", id)
+	}
+	model2.Name = "apple"
+	_, err = hd.Save(&model2)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	var out2 []stringKeyModel
+	err = hd.Find(&out2)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(out2) != 1 || out2[0] != model2 {
+		t.Fatal("wrong rows", out2)
+	}
+	_, err = hd.Save(&stringKeyModel{Name: "pear"})
+	if err != ErrPrimaryKeyNotSet {
+		t.Fatal("wrong error", err)
+	}
+	id, err = hd.Delete(&model2)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if id != "a1" {
+		t.Fatal("wrong id", id)
+	}
+}
+
+type compositeModel struct {
+	UserId int64 `sql:"pk"`
+	RoleId int64 `sql:"pk"`
+	Note   string
+}
+
+func TestCompositePkSql(t *testing.T) {
+	for _, info := range allDialectInfos {
+		model, err := interfaceToModel(&compositeModel{1, 2, "a"})
+		if err != nil {
+			t.Fatal("error not nil", err)
+		}
+		if x, _ := info.dialect.CreateTableSql(model, false); x != info.createTableWithCompositePkSql {
+			t.Fatalf("%T: wrong sql %v", info.dialect, x)
+		}
+		if x, args := info.dialect.UpdateSql(model); x != info.updateWithCompositePkSql || !reflect.DeepEqual(args, []interface{}{"a", int64(1), int64(2)}) {
+			t.Fatalf("%T: wrong sql %v %v", info.dialect, x, args)
+		}
+		if x, args := info.dialect.DeleteSql(model); x != info.deleteWithCompositePkSql || !reflect.DeepEqual(args, []interface{}{int64(1), int64(2)}) {
+			t.Fatalf("%T: wrong sql %v %v", info.dialect, x, args)
+		}
+	}
+}
+
+func TestCompositePk(t *testing.T) {
+	for _, info := range toRun {
+		DoTestCompositePk(t, info)
+	}
+}
+
+func DoTestCompositePk(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hd := info.setupDbFunc(t)
+	type userRole struct {
+		UserId int64 `sql:"pk"`
+		RoleId int64 `sql:"pk"`
+		Note   string
+	}
+	type userRoleNote struct {
+		Note string `sql:"size(64)"`
+	}
+
+	hd.DropTable(&userRole{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&userRole{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+
+	models := []userRole{{1, 1, "a"}, {1, 2, "b"}, {2, 1, "c"}}
+	ids, err := hd.SaveAll(&models)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x := ids[1]; !reflect.DeepEqual(x, []interface{}{int64(1), int64(2)}) {
+		t.Fatal("wrong id", x)
+	}
+	models[1].Note = "x"
+	_, err = hd.Save(&models[1])
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	_, err = hd.Save(&userRole{UserId: 3})
+	if err != ErrPrimaryKeyNotSet {
+		t.Fatal("wrong error", err)
+	}
+	_, err = hd.Delete(&models[0])
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	var out []userRole
+	err = hd.OrderBy("user_id").Find(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(out) != 2 || out[0] != models[1] || out[1] != models[2] {
+		t.Fatal("wrong rows", out)
+	}
+
+	// the composite key survives schema changes
+	tx = mustBegin(t, hd)
+	tx.ChangeColumns(&userRole{}, &userRoleNote{})
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	_, err = hd.Exec("INSERT INTO user_role (user_id, role_id, note) VALUES (1, 2, 'y')")
+	var uniqueErr *UniqueViolationError
+	if !errors.As(err, &uniqueErr) {
+		t.Fatalf("wrong error %T %v", err, err)
+	}
+
+	// saving an existing row without non-key columns updates nothing
+	type joinRow struct {
+		UserId int64 `sql:"pk"`
+		RoleId int64 `sql:"pk"`
+	}
+	hd.DropTable(&joinRow{})
+	tx = mustBegin(t, hd)
+	tx.CreateTable(&joinRow{})
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	row := joinRow{1, 2}
+	for i := 0; i < 2; i++ {
+		id, err := hd.Save(&row)
+		if err != nil {
+			t.Fatal("error not nil", err)
+		}
+		if !reflect.DeepEqual(id, []interface{}{int64(1), int64(2)}) {
+			t.Fatal("wrong id", id)
+		}
+	}
+	if n, _ := hd.Count(&joinRow{}); n != 1 {
+		t.Fatal("wrong row count", n)
+	}
+}
+
+type fkModel struct {
+	Id     Id
+	UserId int64 `sql:"references(users.id),ondelete(cascade)"`
+}
+
+func TestForeignKeySql(t *testing.T) {
+	for _, info := range allDialectInfos {
+		model, err := interfaceToModel(&fkModel{})
+		if err != nil {
+			t.Fatal("error not nil", err)
+		}
+		if x, _ := info.dialect.CreateTableSql(model, false); x != info.createTableWithForeignKeySql {
+			t.Fatalf("%T: wrong sql %v", info.dialect, x)
+		}
+		fk := &ForeignKey{Name: "fk_model_user_id_fkey", Column: "user_id", RefTable: "users", RefColumn: "id", OnDelete: "set null"}
+		if x, _ := info.dialect.AddColumnSql("fk_model", "user_id", int64(0), 0, fk); x != info.addColumnWithForeignKeySql {
+			t.Fatalf("%T: wrong sql %v", info.dialect, x)
+		}
+		fk.OnUpdate = "cascade"
+		if x := info.dialect.AddForeignKeySql("fk_model", fk); x != info.addForeignKeySql {
+			t.Fatalf("%T: wrong sql %v", info.dialect, x)
+		}
+		if x := info.dialect.DropForeignKeySql("fk_model", fk.Name); x != info.dropForeignKeySql {
+			t.Fatalf("%T: wrong sql %v", info.dialect, x)
+		}
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	for _, info := range toRun {
+		DoTestForeignKeys(t, info)
+	}
+}
+
+func DoTestForeignKeys(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hd := info.setupDbFunc(t)
+	type fkUser struct {
+		Id   Id
+		Name string
+	}
+	type fkPost struct {
+		Id       Id
+		FkUserId int64 `sql:"references(fk_user.id),ondelete(cascade)"`
+	}
+	type fkEditor struct {
+		EditorId *int64 `sql:"references(fk_user.id)"`
+	}
+
+	hd.DropTable(&fkPost{})
+	hd.DropTable(&fkUser{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&fkUser{})
+	tx.CreateTable(&fkPost{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	isForeignKeyViolation := func(err error) bool {
+		var fkErr *ForeignKeyViolationError
+		return errors.As(err, &fkErr)
+	}
+
+	user := fkUser{Name: "a"}
+	_, err = hd.Save(&user)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	_, err = hd.Save(&fkPost{FkUserId: int64(user.Id)})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	_, err = hd.Save(&fkPost{FkUserId: 999})
+	if !isForeignKeyViolation(err) {
+		t.Fatalf("wrong error %T %v", err, err)
+	}
+	_, err = hd.Delete(&user)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if n, _ := hd.Count(&fkPost{}); n != 0 {
+		t.Fatal("delete not cascaded", n)
+	}
+
+	// drop and re-add the constraint
+	tx = mustBegin(t, hd)
+	tx.DropForeignKey(&fkPost{}, "fk_user_id")
+	_, err = tx.Save(&fkPost{FkUserId: 999})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	err = tx.Rollback()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	tx = mustBegin(t, hd)
+	tx.DropForeignKey(&fkPost{}, "fk_user_id")
+	tx.AddForeignKey(&fkPost{}, &ForeignKey{Column: "fk_user_id", RefTable: "fk_user", RefColumn: "id"})
+	tx.AddColumns(&fkPost{}, &fkEditor{})
+	err = tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	_, err = hd.Save(&fkPost{FkUserId: 999})
+	if !isForeignKeyViolation(err) {
+		t.Fatalf("wrong error %T %v", err, err)
+	}
+	_, err = hd.Exec("INSERT INTO fk_post (fk_user_id, editor_id) VALUES (NULL, 999)")
+	if !isForeignKeyViolation(err) {
+		t.Fatalf("wrong error %T %v", err, err)
+	}
+}
+
+func TestPreload(t *testing.T) {
+	for _, info := range toRun {
+		DoTestPreload(t, info)
+	}
+}
+
+func DoTestPreload(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hd := info.setupDbFunc(t)
+	type preloadPost struct {
+		Id            Id
+		PreloadUserId int64
+		Title         string
+	}
+	type preloadUser struct {
+		Id    Id
+		Name  string
+		Posts []preloadPost `sql:"has_many(preload_user_id)"`
+	}
+	type preloadComment struct {
+		Id            Id
+		PreloadUserId *int64
+		Author        *preloadUser `sql:"belongs_to(preload_user_id)"`
+	}
+
+	hd.DropTable(&preloadComment{})
+	hd.DropTable(&preloadPost{})
+	hd.DropTable(&preloadUser{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&preloadUser{})
+	tx.CreateTable(&preloadPost{})
+	tx.CreateTable(&preloadComment{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	users := []preloadUser{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	_, err = hd.SaveAll(&users)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	posts := []preloadPost{
+		{PreloadUserId: int64(users[0].Id), Title: "1"},
+		{PreloadUserId: int64(users[1].Id), Title: "2"},
+		{PreloadUserId: int64(users[0].Id), Title: "3"},
+	}
+	_, err = hd.SaveAll(&posts)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	userId := int64(users[1].Id)
+	comments := []preloadComment{{PreloadUserId: &userId}, {}}
+	_, err = hd.SaveAll(&comments)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+
+	var found []preloadUser
+	err = hd.Preload("Posts").OrderBy("id").Find(&found)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x := len(found); x != 3 {
+		t.Fatal("wrong user count", x)
+	}
+	if p := found[0].Posts; len(p) != 2 || p[0].Title != "1" || p[1].Title != "3" {
+		t.Fatal("wrong posts", p)
+	}
+	if p := found[1].Posts; len(p) != 1 || p[0].Title != "2" {
+		t.Fatal("wrong posts", p)
+	}
+	if p := found[2].Posts; p == nil || len(p) != 0 {
+		t.Fatal("wrong posts", p)
+	}
+
+	var foundComments []preloadComment
+	err = hd.Preload("Author").OrderBy("id").Find(&foundComments)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if a := foundComments[0].Author; a == nil || a.Name != "b" || a.Posts != nil {
+		t.Fatal("wrong author", a)
+	}
+	if a := foundComments[1].Author; a != nil {
+		t.Fatal("author set", a)
+	}
+
+	var user preloadUser
+	err = hd.Where("id", "=", users[0].Id).Preload("Posts").First(&user)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(user.Posts) != 2 {
+		t.Fatal("wrong posts", user.Posts)
+	}
+	err = hd.Preload("Name").Find(&found)
+	if err == nil {
+		t.Fatal("non-association preloaded")
+	}
+}
+
+func TestManyToMany(t *testing.T) {
+	for _, info := range toRun {
+		DoTestManyToMany(t, info)
+	}
+}
+
+func DoTestManyToMany(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hd := info.setupDbFunc(t)
+	type mtmRole struct {
+		Id   Id
+		Name string
+	}
+	type mtmUser struct {
+		Id    Id
+		Name  string
+		Roles []*mtmRole `sql:"many_to_many(mtm_user_roles)"`
+	}
+
+	hd.DropTable("mtm_user_roles")
+	hd.DropTable(&mtmUser{})
+	hd.DropTable(&mtmRole{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&mtmRole{})
+	tx.CreateTable(&mtmUser{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	roles := []mtmRole{{Name: "admin"}, {Name: "editor"}, {Name: "viewer"}}
+	_, err = hd.SaveAll(&roles)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	users := []mtmUser{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	_, err = hd.SaveAll(&users)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	err = hd.Associate(&users[0], &roles[0], &roles[1])
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	err = hd.Associate(&users[1], &roles[1])
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if err := hd.Associate(&users[1], &roles[1]); err == nil {
+		t.Fatal("duplicate association added")
+	}
+	if err := hd.Associate(&users[1], &mtmRole{}); err != ErrPrimaryKeyNotSet {
+		t.Fatal("wrong error", err)
+	}
+	roleNames := func(u mtmUser) string {
+		a := []string{}
+		for _, r := range u.Roles {
+			a = append(a, r.Name)
+		}
+		return strings.Join(a, ",")
+	}
+	load := func() []mtmUser {
+		var found []mtmUser
+		err := hd.Preload("Roles").OrderBy("id").Find(&found)
+		if err != nil {
+			t.Fatal("error not nil", err)
+		}
+		if x := len(found); x != 3 {
+			t.Fatal("wrong user count", x)
+		}
+		return found
+	}
+	found := load()
+	if x := roleNames(found[0]); x != "admin,editor" {
+		t.Fatal("wrong roles", x)
+	}
+	if x := roleNames(found[1]); x != "editor" {
+		t.Fatal("wrong roles", x)
+	}
+	if x := found[2].Roles; x == nil || len(x) != 0 {
+		t.Fatal("wrong roles", x)
+	}
+
+	err = hd.Dissociate(&users[0], &roles[0])
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	err = hd.ReplaceAssociations(&users[1], []mtmRole{roles[0], roles[2]})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	found = load()
+	if x := roleNames(found[0]); x != "editor" {
+		t.Fatal("wrong roles", x)
+	}
+	if x := roleNames(found[1]); x != "admin,viewer" {
+		t.Fatal("wrong roles", x)
+	}
+	err = hd.ReplaceAssociations(&found[2], found[1].Roles)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x := roleNames(load()[2]); x != "admin,viewer" {
+		t.Fatal("wrong roles", x)
+	}
+	if err := hd.ReplaceAssociations(&found[2], []*mtmRole{nil}); err == nil {
+		t.Fatal("nil target accepted")
+	}
+	err = hd.ReplaceAssociations(&users[1], &[]mtmRole{})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x := roleNames(load()[1]); x != "" {
+		t.Fatal("wrong roles", x)
+	}
+}
+
+func TestInsertAllSql(t *testing.T) {
+	for _, info := range allDialectInfos {
+		models := []*Model{}
+		for _, name := range []string{"a", "b"} {
+			model, err := interfaceToModel(&sqlGenModel{First: name})
+			if err != nil {
+				t.Fatal("error not nil", err)
+			}
+			models = append(models, model)
+		}
+		if x, args := info.dialect.InsertAllSql(models); x != info.insertAllSql || len(args) != 6 || args[3] != "b" {
+			t.Fatalf("%T: wrong sql %v %v", info.dialect, x, args)
+		}
+		if x := info.dialect.MaxInsertRows(3); x < 1 || x*3 > info.dialect.MaxParams() {
+			t.Fatalf("%T: wrong max insert rows %v", info.dialect, x)
+		}
+	}
+}
+
+func TestInsertAll(t *testing.T) {
+	for _, info := range toRun {
+		DoTestInsertAll(t, info)
+	}
+}
+
+func DoTestInsertAll(t *testing.T, info dialectInfo) {
+	t.Logf("Dialect %T\n", info.dialect)
+	hd := info.setupDbFunc(t)
+	type insertAllModel struct {
+		Id      Id
+		Name    string `validate:"presence"`
+		Index   int
+		Created Created
+	}
+	hd.DropTable(&sdAllModel{})
+	hd.DropTable(&insertAllModel{})
+	tx := mustBegin(t, hd)
+	tx.CreateTable(&sdAllModel{})
+	tx.CreateTable(&insertAllModel{})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+
+	sdAllHooks = make([]string, 0, 20)
+	hooked := []sdAllModel{{A: "A"}, {A: "B"}}
+	ids, err := hd.InsertAll(&hooked)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(ids) != 2 || ids[0] != Id(1) || ids[1] != Id(2) || hooked[1].Id != 2 {
+		t.Fatal("wrong ids", ids, hooked)
+	}
+	if x := strings.Join(sdAllHooks, ","); x != "bsave,binsert,bsave,binsert,ainsert,asave,ainsert,asave" {
+		t.Fatal("wrong hooks", x)
+	}
+
+	// more rows than fit into a single statement
+	n := 3*info.dialect.MaxInsertRows(3) + 1
+	if n > 5000 {
+		n = 5000
+	}
+	rows := make([]insertAllModel, n)
+	for i := range rows {
+		rows[i] = insertAllModel{Name: fmt.Sprintf("row%d", i), Index: i}
+	}
+	ids, err = hd.InsertAll(&rows)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x := len(ids); x != n {
+		t.Fatal("wrong id count", x)
+	}
+	var found []insertAllModel
+	err = hd.OrderBy("id").Find(&found)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x := len(found); x != n {
+		t.Fatal("wrong row count", x)
+	}
+	for i, row := range found {
+		if row.Id != rows[i].Id || ids[i] != row.Id || row.Index != i || row.Created.IsZero() {
+			t.Fatal("wrong row", i, row, rows[i])
+		}
+	}
+
+	invalid := []insertAllModel{{Name: "a"}, {}}
+	_, err = hd.InsertAll(&invalid)
+	if err == nil {
+		t.Fatal("invalid row inserted")
+	}
+	if count, _ := hd.Count(&insertAllModel{}); count != int64(n) {
+		t.Fatal("wrong row count", count)
+	}
+}
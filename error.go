@@ -1,5 +1,11 @@
 package hood
 
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
 const (
 	ValidationErrorValueNotSet = (1<<16 + iota)
 	ValidationErrorValueTooSmall
@@ -49,3 +55,65 @@ func (e *ValidationError) Kind() int {
 func (e *ValidationError) Field() string {
 	return e.field
 }
+
+// UnsupportedTypeError is returned if a field type has no corresponding sql
+// type in the dialect.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("unsupported sql type %v", e.Type)
+}
+
+// ConstraintViolation holds the details of a violated constraint, as far as
+// the database reports them. It is embedded by the constraint violation errors
+// returned by Dialect.ConvertError.
+type ConstraintViolation struct {
+	Table      string // table of the constraint
+	Column     string // affected column, or columns separated by comma
+	Constraint string // name of the constraint or index
+	Err        error  // the original driver error
+}
+
+func (e *ConstraintViolation) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the original driver error.
+func (e *ConstraintViolation) Unwrap() error {
+	return e.Err
+}
+
+// UniqueViolationError is returned if a unique index or primary key is violated.
+type UniqueViolationError struct {
+	ConstraintViolation
+}
+
+// ForeignKeyViolationError is returned if a foreign key constraint is violated.
+type ForeignKeyViolationError struct {
+	ConstraintViolation
+}
+
+// NotNullViolationError is returned if NULL is written to a NOT NULL column.
+type NotNullViolationError struct {
+	ConstraintViolation
+}
+
+// CheckViolationError is returned if a check constraint is violated.
+type CheckViolationError struct {
+	ConstraintViolation
+}
+
+// isConstraintViolation tests if err already has been converted by
+// Dialect.ConvertError, so it isn't wrapped twice.
+func isConstraintViolation(err error) bool {
+	var (
+		unique     *UniqueViolationError
+		foreignKey *ForeignKeyViolationError
+		notNull    *NotNullViolationError
+		check      *CheckViolationError
+	)
+	return errors.As(err, &unique) || errors.As(err, &foreignKey) ||
+		errors.As(err, &notNull) || errors.As(err, &check)
+}
@@ -0,0 +1,122 @@
+package hood
+
+import (
+	"errors"
+	"fmt"
+	gomysqldrv "github.com/go-sql-driver/mysql"
+	"reflect"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+func init() {
+	RegisterDialect("mysql", NewGoMysql())
+}
+
+// gomysql is the dialect for github.com/go-sql-driver/mysql. It generates the
+// same sql as the mymysql dialect, but has to deal with the value types that
+// driver returns.
+type gomysql struct {
+	mysql
+}
+
+// gomysqlTimeFormats are the layouts DATE, DATETIME and TIMESTAMP columns are
+// returned in if the DSN does not set parseTime=true.
+var gomysqlTimeFormats = []string{
+	"2006-01-02 15:04:05.999999",
+	"2006-01-02",
+}
+
+func NewGoMysql() Dialect {
+	d := &gomysql{}
+	d.base.Dialect = d
+	return d
+}
+
+func (d *gomysql) ParseBool(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Bool:
+		return value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return value.Uint() != 0
+	}
+	return false
+}
+
+func (d *gomysql) SetModelValue(driverValue, fieldValue reflect.Value) error {
+	// ignore zero types
+	if !driverValue.Elem().IsValid() {
+		return nil
+	}
+	v := driverValue.Elem().Interface()
+	if b, ok := v.([]byte); ok {
+		// the text protocol returns all values as bytes, the binary protocol
+		// still does for decimals and times if parseTime is not set
+		x, err := d.parseBytes(b, fieldValue.Type())
+		if err != nil {
+			return err
+		}
+		v = x
+	}
+	switch fieldValue.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// unsigned columns are returned as uint64
+		if x := reflect.ValueOf(v); x.Kind() >= reflect.Uint && x.Kind() <= reflect.Uint64 {
+			v = int64(x.Uint())
+		}
+	}
+	return d.base.SetModelValue(reflect.ValueOf(&v).Elem(), fieldValue)
+}
+
+func (d *gomysql) IsRetryable(err error) bool {
+	var mysqlErr *gomysqldrv.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1213 // ER_LOCK_DEADLOCK
+	}
+	return false
+}
+
+// gomysqlError matches the errors returned by the driver, the SQL state is
+// only included by newer driver versions
+var gomysqlError = regexp.MustCompile(`(?s)^Error (\d+)(?: \(\w+\))?: (.*)$`)
+
+func (d *gomysql) ConvertError(err error) error {
+	if err == nil || isConstraintViolation(err) {
+		return err
+	}
+	m := gomysqlError.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	return convertMysqlError(err, m[1], m[2])
+}
+
+func (d *gomysql) parseBytes(b []byte, fieldType reflect.Type) (interface{}, error) {
+	switch fieldType {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(Created{}), reflect.TypeOf(Updated{}):
+		s := string(b)
+		if s == "0000-00-00" || s == "0000-00-00 00:00:00" {
+			return time.Time{}, nil
+		}
+		for _, layout := range gomysqlTimeFormats {
+			if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("cannot parse time value '%s'", s)
+	}
+	switch fieldType.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(string(b))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(string(b), 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(string(b), 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(string(b), 64)
+	}
+	return b, nil
+}
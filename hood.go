@@ -3,7 +3,9 @@
 package hood
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -11,6 +13,7 @@ import (
 	"os"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,33 +21,56 @@ import (
 )
 
 type (
-	// Hood is an ORM handle.
+	// Hood is an ORM handle. Queries are built as Query values, so a Hood can
+	// be shared by multiple goroutines.
 	Hood struct {
-		Db           *sql.DB
-		Dialect      Dialect
-		Log          bool
-		qo           qo     // the query object
-		schema       Schema // keeping track of the schema
-		dryRun       bool   // if actual sql is executed or not
-		selectPaths  []Path
-		selectTable  string
-		where        []interface{}
-		markerPos    int
-		limit        int
-		offset       int
-		orderBy      Path
-		order        string
-		joins        []*join
-		groupBy      Path
-		havingCond   string
-		havingArgs   []interface{}
-		firstTxError error
-		mutex        sync.Mutex
+		Db        *sql.DB
+		Dialect   Dialect
+		Log       bool
+		qo        qo // the query object
+		ctx       context.Context
+		schema    Schema   // keeping track of the schema
+		dryRun    bool     // if actual sql is executed or not
+		txError   *txError // shared by the copies returned by WithContext
+		txDepth   int      // nesting level of the transaction
+		savepoint string   // savepoint of a nested transaction
+	}
+
+	// Iterator streams the rows of a query, see Hood.Iterate.
+	Iterator struct {
+		hood   *Hood
+		stmt   *sql.Stmt
+		rows   *sql.Rows
+		cols   []string
+		values []interface{}
+		err    error
+	}
+
+	// TxOptions holds the options of a transaction started with BeginWith.
+	TxOptions struct {
+		Isolation sql.IsolationLevel // zero uses the driver's default level
+		ReadOnly  bool
+	}
+
+	// jsonColumn wraps the value of a field with the json sql tag, which is
+	// stored as JSON, see ModelField.sqlValue.
+	jsonColumn struct {
+		value interface{}
+	}
+
+	// txError records the first error that occurred inside a transaction.
+	txError struct {
+		mutex sync.Mutex
+		first error
 	}
 
 	// Id represents a auto-incrementing integer primary key type.
 	Id int64
 
+	// UUID represents a universally unique identifier. A zero UUID primary
+	// key, declared using the sql tag "pk", is generated on insert.
+	UUID [16]byte
+
 	// Index represents a table index and is returned via the Indexed interface.
 	Index struct {
 		Name    string
@@ -55,6 +81,18 @@ type (
 	// Indexes represents an array of indexes.
 	Indexes []*Index
 
+	// ForeignKey represents a foreign key constraint on a column, declared
+	// using the sql tags "references(table.column)", "ondelete(action)" and
+	// "onupdate(action)". The constraint is named '<table>_<column>_fkey'.
+	ForeignKey struct {
+		Name      string
+		Column    string
+		RefTable  string
+		RefColumn string
+		OnDelete  string // e.g. cascade, set null or restrict
+		OnUpdate  string
+	}
+
 	// Created denotes a timestamp field that is automatically set on insert.
 	Created struct {
 		time.Time
@@ -67,7 +105,8 @@ type (
 
 	// Model represents a parsed schema interface{}.
 	Model struct {
-		Pk      *ModelField
+		Pk      *ModelField   // The primary key, or the first field of a composite key
+		Pks     []*ModelField // All primary key fields
 		Table   string
 		Fields  []*ModelField
 		Indexes Indexes
@@ -100,27 +139,22 @@ type (
 		Indexes(indexes *Indexes)
 	}
 
-	// TODO: implement aggregate function types
+	// SqlTyper is implemented by custom field types to declare their column
+	// type, e.g.
 	//
-	// // Avg denotes an average aggregate function argument
-	// Avg interface{}
-
-	// // Min denotes an minimum aggregate function argument
-	// Min interface{}
-
-	// // Max denotes an maximum aggregate function argument
-	// Max interface{}
-
-	// // Std denotes an standard derivation aggregate function argument
-	// Std interface{}
-
-	// // Sum denotes an sum aggregate function argument
-	// Sum interface{}
+	//   func (m Money) SqlType(size int) string { return "numeric(12,2)" }
+	//
+	// Values of custom types are written using driver.Valuer and read using
+	// sql.Scanner.
+	SqlTyper interface {
+		SqlType(size int) string
+	}
 
 	qo interface {
-		Prepare(query string) (*sql.Stmt, error)
-		Query(query string, args ...interface{}) (*sql.Rows, error)
-		QueryRow(query string, args ...interface{}) *sql.Row
+		PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+		QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+		QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+		ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 	}
 
 	clause struct {
@@ -133,6 +167,21 @@ type (
 	andClause   clause
 	orClause    clause
 
+	// Cond is a group of conditions that is rendered in parentheses. It is
+	// populated in the functions passed to WhereGroup, AndGroup and OrGroup.
+	Cond struct {
+		where []interface{}
+		err   error
+	}
+
+	group struct {
+		where []interface{}
+	}
+
+	whereGroup group
+	andGroup   group
+	orGroup    group
+
 	join struct {
 		join  Join
 		table string
@@ -171,6 +220,21 @@ func (p Path) Quote(d Dialect) string {
 	return strings.Join(a, sep)
 }
 
+// JSON tests if the field is declared using the sql tag "json" and is stored as
+// JSON.
+func (field *ModelField) JSON() bool {
+	_, ok := field.SqlTags["json"]
+	return ok
+}
+
+// sqlValue returns the value that is written to the column of the field.
+func (field *ModelField) sqlValue() interface{} {
+	if field.JSON() {
+		return jsonColumn{field.Value}
+	}
+	return field.Value
+}
+
 // PrimaryKey tests if the field is declared using the sql tag "pk" or is of type Id
 func (field *ModelField) PrimaryKey() bool {
 	_, isPk := field.SqlTags["pk"]
@@ -178,6 +242,61 @@ func (field *ModelField) PrimaryKey() bool {
 	return isPk || isId
 }
 
+// AutoIncrement tests if the field is an auto-incrementing primary key of type Id
+func (field *ModelField) AutoIncrement() bool {
+	_, isId := field.Value.(Id)
+	return isId
+}
+
+// ForeignKey returns the foreign key constraint the field of table declares
+// using the sql tag "references", or nil.
+func (field *ModelField) ForeignKey(table string) *ForeignKey {
+	ref, ok := field.SqlTags["references"]
+	if !ok {
+		return nil
+	}
+	fk := &ForeignKey{
+		Name:     foreignKeyName(table, field.Name),
+		Column:   field.Name,
+		RefTable: ref,
+		OnDelete: field.SqlTags["ondelete"],
+		OnUpdate: field.SqlTags["onupdate"],
+	}
+	if i := strings.LastIndex(ref, "."); i >= 0 {
+		fk.RefTable, fk.RefColumn = ref[:i], ref[i+1:]
+	}
+	return fk
+}
+
+// setForeignKey replaces the foreign key tags of the field with the ones
+// declaring fk, or removes them if fk is nil.
+func (field *ModelField) setForeignKey(fk *ForeignKey) {
+	tags := []string{}
+	for _, tag := range strings.Split(field.RawTag.Get("sql"), ",") {
+		switch strings.SplitN(tag, "(", 2)[0] {
+		case "", "references", "ondelete", "onupdate":
+		default:
+			tags = append(tags, tag)
+		}
+	}
+	if fk != nil {
+		ref := fk.RefTable
+		if fk.RefColumn != "" {
+			ref += "." + fk.RefColumn
+		}
+		tags = append(tags, "references("+ref+")")
+		if x := fk.OnDelete; x != "" {
+			tags = append(tags, "ondelete("+x+")")
+		}
+		if x := fk.OnUpdate; x != "" {
+			tags = append(tags, "onupdate("+x+")")
+		}
+	}
+	sqlTag := strings.Join(tags, ",")
+	field.SqlTags = parseTags(sqlTag)
+	field.RawTag = replaceTag(field.RawTag, "sql", sqlTag)
+}
+
 // NotNull tests if the field is declared as NOT NULL
 func (field *ModelField) NotNull() bool {
 	_, ok := field.SqlTags["notnull"]
@@ -202,7 +321,7 @@ func (field *ModelField) Size() int {
 // Zero tests wether or not the field is set
 func (field *ModelField) Zero() bool {
 	x := field.Value
-	return x == nil || x == reflect.Zero(reflect.TypeOf(x)).Interface()
+	return x == nil || reflect.ValueOf(x).IsZero()
 }
 
 // String returns the field string value and a bool flag indicating if the
@@ -237,6 +356,23 @@ func (field *ModelField) GoDeclaration() string {
 	)
 }
 
+// structTagPair matches the key:"value" pairs of a struct tag.
+var structTagPair = regexp.MustCompile(`(\w+):"((?:[^"\\]|\\.)*)"`)
+
+// replaceTag sets the value of key in tag, or removes key if value is empty.
+func replaceTag(tag reflect.StructTag, key, value string) reflect.StructTag {
+	a := []string{}
+	for _, m := range structTagPair.FindAllStringSubmatch(string(tag), -1) {
+		if m[1] != key {
+			a = append(a, m[0])
+		}
+	}
+	if value != "" {
+		a = append(a, fmt.Sprintf("%s:%q", key, value))
+	}
+	return reflect.StructTag(strings.Join(a, " "))
+}
+
 // Validate tests if the field conforms to it's validation constraints specified
 // int the "validate" struct tag
 func (field *ModelField) Validate() error {
@@ -278,22 +414,23 @@ func (field *ModelField) Validate() error {
 	return nil
 }
 
-func parseTuple(tuple string) (string, string) {
+func parseTuple(tuple string) (string, string, error) {
 	c := strings.Split(tuple, ":")
-	a := c[0]
-	b := c[1]
-	if len(c) != 2 || (len(a) == 0 && len(b) == 0) {
-		panic("invalid validation tuple")
+	if len(c) != 2 || (len(c[0]) == 0 && len(c[1]) == 0) {
+		return "", "", fmt.Errorf("invalid validation tuple '%s'", tuple)
 	}
-	return a, b
+	return c[0], c[1], nil
 }
 
 func validateLen(s, tuple, field string) error {
-	a, b := parseTuple(tuple)
+	a, b, err := parseTuple(tuple)
+	if err != nil {
+		return err
+	}
 	if len(a) > 0 {
 		min, err := strconv.Atoi(a)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		if len(s) < min {
 			return NewValidationError(ValidationErrorValueTooShort, field)
@@ -302,7 +439,7 @@ func validateLen(s, tuple, field string) error {
 	if len(b) > 0 {
 		max, err := strconv.Atoi(b)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		if len(s) > max {
 			return NewValidationError(ValidationErrorValueTooLong, field)
@@ -312,7 +449,10 @@ func validateLen(s, tuple, field string) error {
 }
 
 func validateRange(i int64, tuple, field string) error {
-	a, b := parseTuple(tuple)
+	a, b, err := parseTuple(tuple)
+	if err != nil {
+		return err
+	}
 	if len(a) > 0 {
 		min, err := strconv.ParseInt(a, 10, 64)
 		if err != nil {
@@ -358,6 +498,48 @@ func (index *Index) GoDeclaration() string {
 	)
 }
 
+// CompositePk tests if the primary key of the model consists of multiple
+// fields.
+func (model *Model) CompositePk() bool {
+	return len(model.Pks) > 1
+}
+
+// AutoIncrement tests if the primary key of the model is generated by the
+// database, i.e. if it is a single field of type Id.
+func (model *Model) AutoIncrement() bool {
+	return !model.CompositePk() && model.Pk != nil && model.Pk.AutoIncrement()
+}
+
+// onlyPks tests if all fields of the model are primary key fields.
+func (model *Model) onlyPks() bool {
+	return len(model.Fields) == len(model.Pks)
+}
+
+// PkValue returns the value of the primary key, or the values of all fields of
+// a composite key as []interface{}.
+func (model *Model) PkValue() interface{} {
+	if !model.CompositePk() {
+		return model.Pk.Value
+	}
+	values := make([]interface{}, 0, len(model.Pks))
+	for _, pk := range model.Pks {
+		values = append(values, pk.Value)
+	}
+	return values
+}
+
+// ForeignKeys returns the foreign key constraints declared by the fields of
+// the model.
+func (model *Model) ForeignKeys() []*ForeignKey {
+	fks := []*ForeignKey{}
+	for _, field := range model.Fields {
+		if fk := field.ForeignKey(model.Table); fk != nil {
+			fks = append(fks, fk)
+		}
+	}
+	return fks
+}
+
 func (model *Model) Validate() error {
 	for _, field := range model.Fields {
 		err := field.Validate()
@@ -395,16 +577,49 @@ func (schema Schema) GoDeclaration() string {
 	return strings.Join(a, "\n\n")
 }
 
+func (schema Schema) hasTable(table string) bool {
+	for _, m := range schema {
+		if m.Table == table {
+			return true
+		}
+	}
+	return false
+}
+
 var registeredDialects map[string]Dialect = make(map[string]Dialect)
 
+var (
+	// ErrNotFound is returned by First and FindSql if no row matches the query.
+	ErrNotFound = errors.New("not found")
+
+	// ErrNoPrimaryKey is returned by Save and Delete if the model has no
+	// primary key field.
+	ErrNoPrimaryKey = errors.New("no primary key field")
+
+	// ErrPrimaryKeyNotSet is returned by Save if a row is inserted with a zero
+	// primary key that is neither an Id nor a UUID.
+	ErrPrimaryKeyNotSet = errors.New("primary key not set")
+
+	// ErrNotInTransaction is returned by schema changes, such as CreateTable,
+	// that are invoked outside of a transaction.
+	ErrNotInTransaction = errors.New("can only be invoked inside a transaction")
+
+	// ErrInvalidTable is returned if a table is neither a string nor a struct.
+	ErrInvalidTable = errors.New("table must be a string or a struct")
+
+	// ErrNoWhereClause is returned by DeleteFrom if the query has no WHERE
+	// clause, to not delete all rows by accident.
+	ErrNoWhereClause = errors.New("no where clause specified")
+)
+
 // New creates a new Hood using the specified DB and dialect.
 func New(database *sql.DB, dialect Dialect) *Hood {
 	hood := &Hood{
 		Db:      database,
 		Dialect: dialect,
 		qo:      database,
+		txError: &txError{},
 	}
-	hood.Reset()
 	return hood
 }
 
@@ -458,45 +673,143 @@ func RegisterDialect(name string, dialect Dialect) {
 	registeredDialects[name] = dialect
 }
 
-// Reset resets the internal state.
-func (hood *Hood) Reset() {
-	hood.selectPaths = nil
-	hood.selectTable = ""
-	hood.where = []interface{}{}
-	hood.markerPos = 0
-	hood.limit = 0
-	hood.offset = 0
-	hood.orderBy = ""
-	hood.order = ""
-	hood.joins = []*join{}
-	hood.groupBy = ""
-	hood.havingCond = ""
-	hood.havingArgs = make([]interface{}, 0, 20)
-}
-
 // Copy copies the hood instance for safe context manipulation.
 func (hood *Hood) Copy() *Hood {
-	c := new(Hood)
-	*c = *hood
-
+	return &Hood{
+		Db:        hood.Db,
+		Dialect:   hood.Dialect,
+		Log:       hood.Log,
+		qo:        hood.qo,
+		ctx:       hood.ctx,
+		schema:    hood.schema,
+		dryRun:    hood.dryRun,
+		txError:   hood.txError,
+		txDepth:   hood.txDepth,
+		savepoint: hood.savepoint,
+	}
+}
+
+// WithContext returns a copy of hood that uses ctx for all statements and
+// transactions, e.g. to cancel queries when a request times out. A transaction
+// started on the copy is rolled back if ctx is done before it is committed.
+func (hood *Hood) WithContext(ctx context.Context) *Hood {
+	if ctx == nil {
+		panic("nil context")
+	}
+	c := hood.Copy()
+	c.ctx = ctx
 	return c
 }
 
+// Context returns the context of hood, which defaults to context.Background.
+func (hood *Hood) Context() context.Context {
+	return hood.context()
+}
+
+func (hood *Hood) context() context.Context {
+	if hood.ctx == nil {
+		return context.Background()
+	}
+	return hood.ctx
+}
+
 // Begin starts a new transaction and returns a copy of Hood. You have to call
 // subsequent methods on the newly returned object.
-func (hood *Hood) Begin() *Hood {
+//
+// If hood already is a transaction, a nested transaction is started by
+// creating a savepoint. Commit then releases the savepoint and Rollback rolls
+// back to it, without ending the outer transaction.
+func (hood *Hood) Begin() (*Hood, error) {
+	return hood.BeginWith(TxOptions{})
+}
+
+// BeginWith works like Begin, but starts the transaction with the specified
+// isolation level and read-only mode, e.g.
+//
+//   tx, err := hd.BeginWith(hood.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+//
+// A nested transaction runs with the options of the outer transaction, so
+// options can only be passed when starting a top-level transaction.
+func (hood *Hood) BeginWith(opts TxOptions) (*Hood, error) {
+	c := hood.Copy()
+	c.txError = &txError{}
+	c.txDepth++
 	if hood.IsTransaction() {
-		panic("cannot start nested transaction")
+		if opts != (TxOptions{}) {
+			return nil, errors.New("options can only be set on a top-level transaction")
+		}
+		c.savepoint = fmt.Sprintf("hood_savepoint_%d", c.txDepth-1)
+		err := c.execTx(c.Dialect.SavepointSql(c.savepoint))
+		if err != nil {
+			return nil, hood.updateTxError(err)
+		}
+		return c, nil
 	}
-	c := hood.Copy()
-	q, err := hood.Db.Begin()
+	q, err := hood.Db.BeginTx(hood.context(), &sql.TxOptions{
+		Isolation: opts.Isolation,
+		ReadOnly:  opts.ReadOnly,
+	})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	c.firstTxError = nil
 	c.qo = q
 
-	return c
+	return c, nil
+}
+
+// Transaction runs f in a new transaction, which is committed if f returns nil
+// and rolled back otherwise. The transaction is also rolled back if any
+// statement inside the transaction failed, even if f ignored the error. If f
+// panics, the transaction is rolled back and the panic is passed on.
+//
+// If hood is a transaction, f runs in a nested transaction, see Begin.
+func (hood *Hood) Transaction(f func(tx *Hood) error) error {
+	return hood.TransactionRetry(0, f)
+}
+
+// TransactionRetry works like Transaction, but runs f again up to retries
+// times if the transaction failed with a serialization failure or deadlock,
+// as detected by the dialect. Nested transactions are never retried, since
+// the outer transaction has to be retried instead.
+func (hood *Hood) TransactionRetry(retries int, f func(tx *Hood) error) error {
+	for attempt := 0; ; attempt++ {
+		err := hood.transaction(f)
+		if err == nil || attempt >= retries || hood.IsTransaction() || !hood.Dialect.IsRetryable(err) {
+			return err
+		}
+		if hood.Log {
+			log.Println("RETRY:", err)
+		}
+	}
+}
+
+func (hood *Hood) transaction(f func(tx *Hood) error) error {
+	tx, err := hood.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	err = f(tx)
+	if err == nil {
+		err = tx.firstError()
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// execTx executes a transaction control statement, which must not be prepared.
+func (hood *Hood) execTx(query string) error {
+	hood.logSql(query)
+	_, err := hood.qo.ExecContext(hood.context(), query)
+	return err
 }
 
 func (hood *Hood) logSql(sql string, args ...interface{}) {
@@ -520,26 +833,43 @@ func (hood *Hood) updateTxError(e error) error {
 			log.Println("ERROR:", e)
 		}
 		// don't shadow the first error
-		if hood.firstTxError == nil {
-			hood.firstTxError = e
+		hood.txError.mutex.Lock()
+		if hood.txError.first == nil {
+			hood.txError.first = e
 		}
+		hood.txError.mutex.Unlock()
 	}
 	return e
 }
 
+func (hood *Hood) firstError() error {
+	hood.txError.mutex.Lock()
+	defer hood.txError.mutex.Unlock()
+	return hood.txError.first
+}
+
 // Commit commits a started transaction and will report the first error that
 // occurred inside the transaction.
 func (hood *Hood) Commit() error {
+	if hood.savepoint != "" {
+		if query := hood.Dialect.ReleaseSavepointSql(hood.savepoint); query != "" {
+			hood.updateTxError(hood.execTx(query))
+		}
+		return hood.firstError()
+	}
 	if v, ok := hood.qo.(*sql.Tx); ok {
 		err := v.Commit()
 		hood.updateTxError(err)
-		return hood.firstTxError
+		return hood.firstError()
 	}
 	return nil
 }
 
 // Rollback rolls back a started transaction.
 func (hood *Hood) Rollback() error {
+	if hood.savepoint != "" {
+		return hood.execTx(hood.Dialect.RollbackToSavepointSql(hood.savepoint))
+	}
 	if v, ok := hood.qo.(*sql.Tx); ok {
 		return v.Rollback()
 	}
@@ -554,171 +884,296 @@ func (hood *Hood) IsTransaction() bool {
 
 // GoSchema returns a string of the schema file in Go syntax.
 func (hood *Hood) GoSchema() string {
-	timeRequired := false
-L:
+	hoodPath := reflect.TypeOf(Id(0)).PkgPath()
+	imports := map[string]bool{}
 	for _, m := range hood.schema {
 		for _, f := range m.Fields {
-			switch f.Value.(type) {
-			case time.Time:
-				timeRequired = true
-				break L
-			}
+			addImports(imports, reflect.TypeOf(f.Value))
 		}
 	}
+	paths := []string{}
+	for path := range imports {
+		if path != hoodPath {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
 	head := []string{
 		"package db",
 		"",
 		"import (",
-		"\t\"github.com/eaigner/hood\"",
+		"\t\"" + hoodPath + "\"",
 	}
-	if timeRequired {
-		head = append(head, "\t\"time\"")
+	for _, path := range paths {
+		head = append(head, "\t\""+path+"\"")
 	}
 	head = append(head, []string{")\n\n", hood.schema.GoDeclaration()}...)
 
 	return strings.Join(head, "\n")
 }
 
-// Select adds a SELECT clause to the query with the specified table and columns.
-// The table can either be a string or it's name can be inferred from the passed
-// interface{} type.
-func (hood *Hood) Select(table interface{}, paths ...Path) *Hood {
-	hood.selectPaths = paths
-	switch f := table.(type) {
-	case string:
-		hood.selectTable = f
-	case interface{}:
-		hood.selectTable = interfaceToSnake(f)
-	default:
-		panic("invalid table")
+// addImports adds the package paths required to declare a field of type t,
+// e.g. time for time.Time.
+func addImports(imports map[string]bool, t reflect.Type) {
+	switch t.Kind() {
+	case reflect.Array, reflect.Ptr, reflect.Slice:
+		if t.Name() == "" {
+			addImports(imports, t.Elem())
+			return
+		}
+	case reflect.Map:
+		if t.Name() == "" {
+			addImports(imports, t.Key())
+			addImports(imports, t.Elem())
+			return
+		}
+	}
+	if path := t.PkgPath(); path != "" {
+		imports[path] = true
 	}
-	return hood
 }
 
-// Where adds a WHERE clause to the query. You can concatenate using the
-// And and Or methods.
-func (hood *Hood) Where(a Path, op string, b interface{}) *Hood {
-	hood.where = append(hood.where, &whereClause{
-		a:  a,
-		op: op,
-		b:  b,
-	})
-	return hood
+// query returns an empty query on hood.
+func (hood *Hood) query() *Query {
+	return &Query{hood: hood}
 }
 
-// Where adds a AND clause to the WHERE query. You can concatenate using the
-// And and Or methods.
-func (hood *Hood) And(a Path, op string, b interface{}) *Hood {
-	hood.where = append(hood.where, &andClause{
-		a:  a,
-		op: op,
-		b:  b,
-	})
-	return hood
+// Select starts a new query with a SELECT clause, see Query.Select.
+func (hood *Hood) Select(table interface{}, paths ...Path) *Query {
+	return hood.query().Select(table, paths...)
 }
 
-// Where adds a OR clause to the WHERE query. You can concatenate using the
-// And and Or methods.
-func (hood *Hood) Or(a Path, op string, b interface{}) *Hood {
-	hood.where = append(hood.where, &orClause{
-		a:  a,
-		op: op,
-		b:  b,
-	})
-	return hood
+// Where starts a new query with a WHERE clause, see Query.Where.
+func (hood *Hood) Where(a Path, op string, b interface{}) *Query {
+	return hood.query().Where(a, op, b)
 }
 
-// Limit adds a LIMIT clause to the query.
-func (hood *Hood) Limit(limit int) *Hood {
-	hood.limit = limit
-	return hood
+// WhereGroup starts a new query with a grouped WHERE clause, see
+// Query.WhereGroup.
+func (hood *Hood) WhereGroup(f func(c *Cond)) *Query {
+	return hood.query().WhereGroup(f)
 }
 
-// Offset adds an OFFSET clause to the query.
-func (hood *Hood) Offset(offset int) *Hood {
-	hood.offset = offset
-	return hood
+// Join starts a new query with a JOIN clause, see Query.Join.
+func (hood *Hood) Join(op Join, table interface{}, a Path, b Path) *Query {
+	return hood.query().Join(op, table, a, b)
 }
 
-// OrderBy adds an ORDER BY clause to the query.
-func (hood *Hood) OrderBy(path Path) *Hood {
-	hood.orderBy = path
-	return hood
+// OrderBy starts a new query with an ORDER BY clause.
+func (hood *Hood) OrderBy(path Path) *Query {
+	return hood.query().OrderBy(path)
 }
 
-func (hood *Hood) Asc() *Hood {
-	hood.order = "ASC"
-	return hood
+// GroupBy starts a new query with a GROUP BY clause.
+func (hood *Hood) GroupBy(path Path) *Query {
+	return hood.query().GroupBy(path)
 }
 
-func (hood *Hood) Desc() *Hood {
-	hood.order = "DESC"
-	return hood
+// Preload starts a new query loading an association, see Query.Preload.
+func (hood *Hood) Preload(name string) *Query {
+	return hood.query().Preload(name)
 }
 
-// Join performs a JOIN on tables, for example
-//   Join(hood.InnerJoin, &User{}, "user.id", "order.id")
-func (hood *Hood) Join(op Join, table interface{}, a Path, b Path) *Hood {
-	hood.joins = append(hood.joins, &join{
-		join:  op,
-		table: tableName(table),
-		a:     a,
-		b:     b,
-	})
-	return hood
+// Limit starts a new query with a LIMIT clause.
+func (hood *Hood) Limit(limit int) *Query {
+	return hood.query().Limit(limit)
 }
 
-// GroupBy adds a GROUP BY clause to the query.
-func (hood *Hood) GroupBy(path Path) *Hood {
-	hood.groupBy = path
-	return hood
+// Offset starts a new query with an OFFSET clause.
+func (hood *Hood) Offset(offset int) *Query {
+	return hood.query().Offset(offset)
 }
 
-// Having adds a HAVING clause to the query.
-func (hood *Hood) Having(condition string, args ...interface{}) *Hood {
-	hood.havingCond = condition
-	hood.havingArgs = append(hood.havingArgs, args...)
-	return hood
+func newGroup(f func(c *Cond)) ([]interface{}, error) {
+	c := &Cond{}
+	f(c)
+	return c.where, c.err
 }
 
-// Find performs a find using the previously specified query. If no explicit
-// SELECT clause was specified earlier, the select is inferred from the passed
-// interface type.
-func (hood *Hood) Find(out interface{}) error {
-	// infer the select statement from the type if not set
-	if hood.selectTable == "" {
-		hood.Select(out)
+func (c *Cond) updateError(e error) {
+	// don't shadow the first error
+	if c.err == nil {
+		c.err = e
 	}
-	query, args := hood.Dialect.QuerySql(hood)
-	return hood.FindSql(out, query, args...)
 }
 
-// FindSql performs a find using the specified custom sql query and arguments and
-// writes the results to the specified out interface{}.
-func (hood *Hood) FindSql(out interface{}, query string, args ...interface{}) error {
-	hood.mutex.Lock()
-	defer hood.mutex.Unlock()
-	defer hood.Reset()
+// Where adds the first condition to the group.
+func (c *Cond) Where(a Path, op string, b interface{}) *Cond {
+	x, err := newClause(a, op, b)
+	c.updateError(err)
+	c.where = append(c.where, (*whereClause)(x))
+	return c
+}
+
+// And adds an AND condition to the group.
+func (c *Cond) And(a Path, op string, b interface{}) *Cond {
+	x, err := newClause(a, op, b)
+	c.updateError(err)
+	c.where = append(c.where, (*andClause)(x))
+	return c
+}
+
+// Or adds an OR condition to the group.
+func (c *Cond) Or(a Path, op string, b interface{}) *Cond {
+	x, err := newClause(a, op, b)
+	c.updateError(err)
+	c.where = append(c.where, (*orClause)(x))
+	return c
+}
+
+// WhereGroup adds a nested group as the first condition to the group.
+func (c *Cond) WhereGroup(f func(c *Cond)) *Cond {
+	where, err := newGroup(f)
+	c.updateError(err)
+	c.where = append(c.where, &whereGroup{where})
+	return c
+}
+
+// AndGroup adds a nested group as AND condition to the group.
+func (c *Cond) AndGroup(f func(c *Cond)) *Cond {
+	where, err := newGroup(f)
+	c.updateError(err)
+	c.where = append(c.where, &andGroup{where})
+	return c
+}
+
+// OrGroup adds a nested group as OR condition to the group.
+func (c *Cond) OrGroup(f func(c *Cond)) *Cond {
+	where, err := newGroup(f)
+	c.updateError(err)
+	c.where = append(c.where, &orGroup{where})
+	return c
+}
 
-	panicMsg := errors.New("expected pointer to struct slice *[]struct")
-	if x := reflect.TypeOf(out).Kind(); x != reflect.Ptr {
-		panic(panicMsg)
+func newClause(a Path, op string, b interface{}) (*clause, error) {
+	c := &clause{
+		a:  a,
+		op: strings.ToUpper(strings.Join(strings.Fields(op), " ")),
+		b:  b,
+	}
+	switch c.op {
+	case "=", "!=", "<>", "<", "<=", ">", ">=", "LIKE", "NOT LIKE", "IS NULL", "IS NOT NULL":
+	case "IN", "NOT IN":
+		if _, ok := c.list(); !ok {
+			return c, fmt.Errorf("operator %s expects a slice value, got %T", c.op, b)
+		}
+	case "BETWEEN", "NOT BETWEEN":
+		if list, ok := c.list(); !ok || list.Len() != 2 {
+			return c, fmt.Errorf("operator %s expects a slice of two values, got %v", c.op, b)
+		}
+	default:
+		return c, fmt.Errorf("invalid operator '%s'", op)
 	}
-	sliceValue := reflect.Indirect(reflect.ValueOf(out))
-	if x := sliceValue.Kind(); x != reflect.Slice {
-		panic(panicMsg)
+	return c, nil
+}
+
+// list returns the clause value as slice, if it is one.
+func (c *clause) list() (reflect.Value, bool) {
+	v := reflect.ValueOf(c.b)
+	switch v.Kind() {
+	case reflect.Slice:
+		// []byte is a single value
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v, false
+		}
+		return v, true
+	case reflect.Array:
+		return v, true
 	}
-	sliceType := sliceValue.Type().Elem()
-	if x := sliceType.Kind(); x != reflect.Struct {
-		panic(panicMsg)
+	return v, false
+}
+
+// Find performs a find on the table inferred from the passed interface type,
+// see Query.Find.
+func (hood *Hood) Find(out interface{}) error {
+	return hood.query().Find(out)
+}
+
+// First finds the first row of the table inferred from the passed interface
+// type, see Query.First.
+func (hood *Hood) First(out interface{}) error {
+	return hood.query().First(out)
+}
+
+// Count returns the number of rows in table.
+func (hood *Hood) Count(table interface{}) (int64, error) {
+	return hood.query().Count(table)
+}
+
+// Sum returns the sum of the column at path for all rows in table.
+func (hood *Hood) Sum(table interface{}, path Path) (float64, error) {
+	return hood.query().Sum(table, path)
+}
+
+// Avg returns the average of the column at path for all rows in table.
+func (hood *Hood) Avg(table interface{}, path Path) (float64, error) {
+	return hood.query().Avg(table, path)
+}
+
+// Min writes the minimum of the column at path for all rows in table to out,
+// see Query.Min.
+func (hood *Hood) Min(table interface{}, path Path, out interface{}) error {
+	return hood.query().Min(table, path, out)
+}
+
+// Max writes the maximum of the column at path for all rows in table to out,
+// see Query.Max.
+func (hood *Hood) Max(table interface{}, path Path, out interface{}) error {
+	return hood.query().Max(table, path, out)
+}
+
+// Iterate streams all rows of the table inferred from the passed interface
+// type, see Query.Iterate.
+func (hood *Hood) Iterate(table interface{}) (*Iterator, error) {
+	return hood.query().Iterate(table)
+}
+
+// FindInBatches loads all rows of the table inferred from out batchSize rows
+// at a time, see Query.FindInBatches.
+func (hood *Hood) FindInBatches(out interface{}, batchSize int, f func() error) error {
+	return hood.query().FindInBatches(out, batchSize, f)
+}
+
+// FindSql performs a find using the specified custom sql query and arguments and
+// writes the results to the specified out interface{}. out can be a pointer to
+//
+//   - a struct slice, e.g. *[]User, columns are matched to fields by name
+//   - a slice of maps, *[]map[string]interface{}, holding all columns by name
+//   - any other slice, e.g. *[]string, the query must return a single column
+//   - a struct, e.g. *User, ErrNotFound is returned if there is no row
+func (hood *Hood) FindSql(out interface{}, query string, args ...interface{}) error {
+	outValue := reflect.ValueOf(out)
+	if outValue.Kind() != reflect.Ptr || outValue.IsNil() {
+		return errors.New("expected pointer to slice or struct")
+	}
+	outValue = outValue.Elem()
+	var scan func(cols []string, values []interface{}) error
+	switch {
+	case isRowStruct(outValue.Type()):
+		scan = func(cols []string, values []interface{}) error {
+			return hood.setRowValue(outValue, cols, values)
+		}
+	case outValue.Kind() == reflect.Slice:
+		elemType := outValue.Type().Elem()
+		scan = func(cols []string, values []interface{}) error {
+			elem := reflect.New(elemType).Elem()
+			err := hood.setRowValue(elem, cols, values)
+			if err != nil {
+				return err
+			}
+			outValue.Set(reflect.Append(outValue, elem))
+			return nil
+		}
+	default:
+		return errors.New("expected pointer to slice or struct")
 	}
 	hood.logSql(query, args...)
-	stmt, err := hood.qo.Prepare(query)
+	stmt, err := hood.qo.PrepareContext(hood.context(), query)
 	if err != nil {
 		return hood.updateTxError(err)
 	}
 	defer stmt.Close()
-	rows, err := stmt.Query(args...)
+	rows, err := stmt.QueryContext(hood.context(), args...)
 	if err != nil {
 		return hood.updateTxError(err)
 	}
@@ -727,74 +1182,257 @@ func (hood *Hood) FindSql(out interface{}, query string, args ...interface{}) er
 	if err != nil {
 		return hood.updateTxError(err)
 	}
+	found := false
 	for rows.Next() {
+		values := make([]interface{}, len(cols))
 		containers := make([]interface{}, 0, len(cols))
-		for i := 0; i < cap(containers); i++ {
-			var v interface{}
-			containers = append(containers, &v)
+		for i := range values {
+			containers = append(containers, &values[i])
 		}
 		err := rows.Scan(containers...)
 		if err != nil {
 			return err
 		}
-		// create a new row and fill
-		rowValue := reflect.New(sliceType)
-		for i, v := range containers {
-			key := cols[i]
-			value := reflect.Indirect(reflect.ValueOf(v))
+		err = scan(cols, values)
+		if err != nil {
+			return err
+		}
+		found = true
+		if outValue.Kind() == reflect.Struct {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return hood.updateTxError(err)
+	}
+	if !found && outValue.Kind() == reflect.Struct {
+		return ErrNotFound
+	}
+	return nil
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// isRowStruct returns true if rows are scanned into values of type t field by
+// field. Special struct types like time.Time and sql.Scanner implementations
+// are scanned as a single value.
+func isRowStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct || reflect.PtrTo(t).Implements(scannerType) {
+		return false
+	}
+	switch t {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(Created{}), reflect.TypeOf(Updated{}):
+		return false
+	}
+	return true
+}
+
+// isJSONField returns true if the struct field is declared using the sql tag
+// "json".
+func isJSONField(f reflect.StructField) bool {
+	_, ok := parseTags(f.Tag.Get("sql"))["json"]
+	return ok
+}
+
+// setRowValue sets value to the scanned row. Structs are set field by field,
+// matching the column names, maps hold all columns by name and all other types
+// require a single column.
+func (hood *Hood) setRowValue(value reflect.Value, cols []string, values []interface{}) error {
+	switch {
+	case isRowStruct(value.Type()):
+		for i, key := range cols {
 			name := snakeToUpperCamel(key)
-			field := rowValue.Elem().FieldByName(name)
-			if field.IsValid() {
-				err = hood.Dialect.SetModelValue(value, field)
-				if err != nil {
-					return err
-				}
+			field := value.FieldByName(name)
+			if !field.IsValid() {
+				continue
 			}
+			var err error
+			if f, _ := value.Type().FieldByName(name); isJSONField(f) {
+				err = setJSONValue(values[i], field)
+			} else {
+				err = setModelValue(hood.Dialect, reflect.ValueOf(&values[i]).Elem(), field)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case value.Type() == reflect.TypeOf(map[string]interface{}{}):
+		m := make(map[string]interface{}, len(cols))
+		for i, c := range cols {
+			m[c] = values[i]
+		}
+		value.Set(reflect.ValueOf(m))
+		return nil
+	case len(cols) != 1:
+		return fmt.Errorf("expected a single column, got %d", len(cols))
+	}
+	return setModelValue(hood.Dialect, reflect.ValueOf(&values[0]).Elem(), value)
+}
+
+// Value marshals the wrapped value to JSON. Nil maps, slices and pointers
+// are written as NULL.
+func (j jsonColumn) Value() (driver.Value, error) {
+	v := reflect.ValueOf(j.value)
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
 		}
-		// append to output
-		sliceValue.Set(reflect.Append(sliceValue, rowValue.Elem()))
 	}
+	b, err := json.Marshal(j.value)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// setJSONValue unmarshals the JSON driverValue into fieldValue. NULL sets
+// fieldValue to its zero value.
+func setJSONValue(driverValue interface{}, fieldValue reflect.Value) error {
+	var b []byte
+	switch v := driverValue.(type) {
+	case nil:
+		fieldValue.Set(reflect.Zero(fieldValue.Type()))
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return fmt.Errorf("cannot unmarshal %T as JSON", driverValue)
+	}
+	v := reflect.New(fieldValue.Type())
+	err := json.Unmarshal(b, v.Interface())
+	if err != nil {
+		return err
+	}
+	fieldValue.Set(v.Elem())
 	return nil
 }
 
+// setModelValue sets fieldValue to the scanned driverValue. Pointer fields are
+// set to nil for NULL. Fields that implement sql.Scanner scan the driver value
+// themselves, all other fields are set by the dialect.
+func setModelValue(d Dialect, driverValue, fieldValue reflect.Value) error {
+	if fieldValue.Kind() == reflect.Ptr {
+		if driverValue.IsNil() {
+			fieldValue.Set(reflect.Zero(fieldValue.Type()))
+			return nil
+		}
+		v := reflect.New(fieldValue.Type().Elem())
+		err := setModelValue(d, driverValue, v.Elem())
+		if err != nil {
+			return err
+		}
+		fieldValue.Set(v)
+		return nil
+	}
+	if fieldValue.CanAddr() {
+		if s, ok := fieldValue.Addr().Interface().(sql.Scanner); ok {
+			return s.Scan(driverValue.Interface())
+		}
+	}
+	return d.SetModelValue(driverValue, fieldValue)
+}
+
+// IterateSql returns an Iterator streaming the rows of the specified custom sql
+// query.
+func (hood *Hood) IterateSql(query string, args ...interface{}) (*Iterator, error) {
+	hood.logSql(query, args...)
+	stmt, err := hood.qo.PrepareContext(hood.context(), query)
+	if err != nil {
+		return nil, hood.updateTxError(err)
+	}
+	rows, err := stmt.QueryContext(hood.context(), args...)
+	if err != nil {
+		stmt.Close()
+		return nil, hood.updateTxError(err)
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		stmt.Close()
+		return nil, hood.updateTxError(err)
+	}
+	return &Iterator{hood: hood, stmt: stmt, rows: rows, cols: cols}, nil
+}
+
+// Next advances the iterator to the next row, which can then be read with Scan.
+// It returns false if there are no more rows or an error occurred, see Err.
+func (it *Iterator) Next() bool {
+	if it.err != nil || !it.rows.Next() {
+		return false
+	}
+	it.values = make([]interface{}, len(it.cols))
+	containers := make([]interface{}, 0, len(it.cols))
+	for i := range it.values {
+		containers = append(containers, &it.values[i])
+	}
+	it.err = it.rows.Scan(containers...)
+	return it.err == nil
+}
+
+// Scan writes the current row to out, which must be a pointer to a struct, a
+// map[string]interface{} or, for single column queries, any other value.
+func (it *Iterator) Scan(out interface{}) error {
+	if it.values == nil {
+		return errors.New("no current row, call Next first")
+	}
+	outValue := reflect.ValueOf(out)
+	if outValue.Kind() != reflect.Ptr || outValue.IsNil() {
+		return errors.New("expected pointer to value")
+	}
+	return it.hood.setRowValue(outValue.Elem(), it.cols, it.values)
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *Iterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.rows.Err()
+}
+
+// Close closes the iterator. It is safe to call Close multiple times.
+func (it *Iterator) Close() error {
+	err := it.rows.Close()
+	if e := it.stmt.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
 // Exec executes a raw sql query.
 func (hood *Hood) Exec(query string, args ...interface{}) (sql.Result, error) {
-	hood.mutex.Lock()
-	defer hood.mutex.Unlock()
-	defer hood.Reset()
-
-	query = hood.substituteMarkers(query)
+	query = substituteMarkers(hood.Dialect, query)
 	hood.logSql(query, args...)
-	stmt, err := hood.qo.Prepare(query + ";")
+	stmt, err := hood.qo.PrepareContext(hood.context(), query+";")
 	if err != nil {
 		return nil, hood.updateTxError(err)
 	}
 	defer stmt.Close()
-	result, err := stmt.Exec(hood.convertSpecialTypes(args)...)
+	result, err := stmt.ExecContext(hood.context(), hood.convertSpecialTypes(args)...)
 	if err != nil {
-		return nil, hood.updateTxError(err)
+		return nil, hood.updateTxError(hood.Dialect.ConvertError(err))
 	}
 	return result, nil
 }
 
 // Query executes a query that returns rows, typically a SELECT
 func (hood *Hood) Query(query string, args ...interface{}) (*sql.Rows, error) {
-	hood.mutex.Lock()
-	defer hood.mutex.Unlock()
-
 	hood.logSql(query, args...)
-	return hood.qo.Query(query, hood.convertSpecialTypes(args)...)
+	return hood.qo.QueryContext(hood.context(), query, hood.convertSpecialTypes(args)...)
 }
 
 // QueryRow executes a query that is expected to return at most one row.
 // QueryRow always return a non-nil value. Errors are deferred until Row's Scan
 // method is called.
 func (hood *Hood) QueryRow(query string, args ...interface{}) *sql.Row {
-	hood.mutex.Lock()
-	defer hood.mutex.Unlock()
-
 	hood.logSql(query, args...)
-	return hood.qo.QueryRow(query, hood.convertSpecialTypes(args)...)
+	return hood.qo.QueryRowContext(hood.context(), query, hood.convertSpecialTypes(args)...)
 	// TODO: switch to this implementation, as soon as
 	//
 	//   https://github.com/bmizerany/pq/issues/68
@@ -802,7 +1440,7 @@ func (hood *Hood) QueryRow(query string, args ...interface{}) *sql.Row {
 	// is resolved!
 	//
 	//
-	// query = hood.substituteMarkers(query)
+	// query = substituteMarkers(hood.Dialect, query)
 	// if hood.Log {
 	// 	fmt.Println(query)
 	// }
@@ -862,10 +1500,12 @@ func callModelMethod(f interface{}, methodName string, isPrefix bool) error {
 	return nil
 }
 
-// Save performs an INSERT, or UPDATE if the passed structs Id is set.
-func (hood *Hood) Save(f interface{}) (Id, error) {
+// Save performs an INSERT, or UPDATE if the row of the passed struct exists,
+// and returns its primary key. Rows with an Id key exist once the Id is set,
+// rows with other keys are looked up. A zero UUID key is generated on insert.
+func (hood *Hood) Save(f interface{}) (interface{}, error) {
 	var (
-		id  Id = -1
+		id  interface{}
 		err error
 	)
 	model, err := interfaceToModel(f)
@@ -881,10 +1521,13 @@ func (hood *Hood) Save(f interface{}) (Id, error) {
 		return id, err
 	}
 	if model.Pk == nil {
-		panic("no primary key field")
+		return id, ErrNoPrimaryKey
 	}
 	now := time.Now()
-	isUpdate := model.Pk != nil && !model.Pk.Zero()
+	isUpdate, err := hood.exists(f, model)
+	if err != nil {
+		return id, err
+	}
 	if isUpdate {
 		err = callModelMethod(f, "BeforeUpdate", false)
 		if err != nil {
@@ -896,7 +1539,12 @@ func (hood *Hood) Save(f interface{}) (Id, error) {
 				f.Value = now
 			}
 		}
-		id, err = hood.Dialect.Update(hood, model)
+		if model.onlyPks() {
+			// there's nothing to set, e.g. in join tables
+			id = model.PkValue()
+		} else {
+			id, err = hood.Dialect.Update(hood, model)
+		}
 		if err == nil {
 			err = callModelMethod(f, "AfterUpdate", false)
 		}
@@ -905,6 +1553,10 @@ func (hood *Hood) Save(f interface{}) (Id, error) {
 		if err != nil {
 			return id, err
 		}
+		err = generatePk(hood.Dialect, model)
+		if err != nil {
+			return id, err
+		}
 		for _, f := range model.Fields {
 			switch f.Value.(type) {
 			case Created, Updated:
@@ -912,6 +1564,8 @@ func (hood *Hood) Save(f interface{}) (Id, error) {
 			}
 		}
 		id, err = hood.Dialect.Insert(hood, model)
+		// inserts may not be executed with Exec, e.g. to return the id
+		err = hood.Dialect.ConvertError(err)
 		if err == nil {
 			err = callModelMethod(f, "AfterInsert", false)
 		}
@@ -919,37 +1573,89 @@ func (hood *Hood) Save(f interface{}) (Id, error) {
 	if err == nil {
 		err = callModelMethod(f, "AfterSave", false)
 	}
-	if id != -1 {
-		// update model id after save
-		structValue := reflect.Indirect(reflect.ValueOf(f))
-		for i := 0; i < structValue.NumField(); i++ {
-			field := structValue.Field(i)
-			switch field.Interface().(type) {
-			case Id:
-				field.SetInt(int64(id))
-			case Updated:
-				field.Set(reflect.ValueOf(Updated{now}))
-			case Created:
-				if !isUpdate {
-					field.Set(reflect.ValueOf(Created{now}))
-				}
+	if id != nil {
+		setSavedFields(f, model, id, now, isUpdate)
+	}
+	return id, err
+}
+
+// setSavedFields updates the primary key and the Created and Updated fields of
+// the struct f after model was saved.
+func setSavedFields(f interface{}, model *Model, id interface{}, now time.Time, isUpdate bool) {
+	if !model.CompositePk() {
+		model.Pk.Value = id
+	}
+	structValue := reflect.Indirect(reflect.ValueOf(f))
+	for _, pk := range model.Pks {
+		if field := structValue.FieldByName(snakeToUpperCamel(pk.Name)); field.IsValid() {
+			field.Set(reflect.ValueOf(pk.Value))
+		}
+	}
+	for i := 0; i < structValue.NumField(); i++ {
+		field := structValue.Field(i)
+		switch field.Interface().(type) {
+		case Updated:
+			field.Set(reflect.ValueOf(Updated{now}))
+		case Created:
+			if !isUpdate {
+				field.Set(reflect.ValueOf(Created{now}))
 			}
 		}
 	}
-	return id, err
 }
 
-func (hood *Hood) doAll(f interface{}, doFunc func(f2 interface{}) (Id, error)) ([]Id, error) {
-	panicMsg := "expected pointer to struct slice *[]struct"
-	if reflect.TypeOf(f).Kind() != reflect.Ptr {
-		panic(panicMsg)
+// exists tests if the row of model has already been inserted.
+func (hood *Hood) exists(f interface{}, model *Model) (bool, error) {
+	for _, pk := range model.Pks {
+		if pk.Zero() {
+			return false, nil
+		}
+	}
+	if model.AutoIncrement() {
+		return true, nil
+	}
+	q := hood.query()
+	for i, pk := range model.Pks {
+		if i == 0 {
+			q = q.Where(Path(pk.Name), "=", pk.Value)
+		} else {
+			q = q.And(Path(pk.Name), "=", pk.Value)
+		}
+	}
+	n, err := q.Count(f)
+	return n > 0, err
+}
+
+// generatePk generates the zero primary key fields of model that are UUIDs.
+// All other keys are either generated by the database, or have to be set.
+func generatePk(dialect Dialect, model *Model) error {
+	if generatedPk(dialect, model) {
+		return nil
+	}
+	for _, pk := range model.Pks {
+		if !pk.Zero() {
+			continue
+		}
+		if _, ok := pk.Value.(UUID); !ok {
+			return ErrPrimaryKeyNotSet
+		}
+		u, err := NewUUID()
+		if err != nil {
+			return err
+		}
+		pk.Value = u
 	}
-	if reflect.TypeOf(f).Elem().Kind() != reflect.Slice {
-		panic(panicMsg)
+	return nil
+}
+
+func (hood *Hood) doAll(f interface{}, doFunc func(f2 interface{}) (interface{}, error)) ([]interface{}, error) {
+	t := reflect.TypeOf(f)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice {
+		return nil, errors.New("expected pointer to struct slice *[]struct")
 	}
 	sliceValue := reflect.ValueOf(f).Elem()
 	sliceLen := sliceValue.Len()
-	ids := make([]Id, 0, sliceLen)
+	ids := make([]interface{}, 0, sliceLen)
 	for i := 0; i < sliceLen; i++ {
 		id, err := doFunc(sliceValue.Index(i).Addr().Interface())
 		if err != nil {
@@ -961,51 +1667,131 @@ func (hood *Hood) doAll(f interface{}, doFunc func(f2 interface{}) (Id, error))
 }
 
 // SaveAll performs an INSERT or UPDATE on a slice of structs.
-func (hood *Hood) SaveAll(f interface{}) ([]Id, error) {
-	return hood.doAll(f, func(f2 interface{}) (Id, error) {
+func (hood *Hood) SaveAll(f interface{}) ([]interface{}, error) {
+	return hood.doAll(f, func(f2 interface{}) (interface{}, error) {
 		return hood.Save(f2)
 	})
 }
 
-// Delete deletes the row matching the specified structs Id.
-func (hood *Hood) Delete(f interface{}) (Id, error) {
+// InsertAll inserts a slice of structs using multi-row INSERT statements, each
+// inserting as many rows as the dialect allows, in a transaction. Like Save,
+// it validates the rows, calls their hooks and sets their primary keys, but
+// never updates existing rows. It returns the primary keys of the rows.
+func (hood *Hood) InsertAll(f interface{}) ([]interface{}, error) {
+	t := reflect.TypeOf(f)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Slice {
+		return nil, errors.New("expected pointer to struct slice *[]struct")
+	}
+	sliceValue := reflect.ValueOf(f).Elem()
+	rows := make([]interface{}, 0, sliceValue.Len())
+	models := make([]*Model, 0, sliceValue.Len())
+	now := time.Now()
+	for i := 0; i < sliceValue.Len(); i++ {
+		row := sliceValue.Index(i).Addr().Interface()
+		model, err := interfaceToModel(row)
+		if err != nil {
+			return nil, err
+		}
+		err = model.Validate()
+		if err != nil {
+			return nil, err
+		}
+		err = callModelMethod(row, "BeforeSave", false)
+		if err != nil {
+			return nil, err
+		}
+		if model.Pk == nil {
+			return nil, ErrNoPrimaryKey
+		}
+		err = callModelMethod(row, "BeforeInsert", false)
+		if err != nil {
+			return nil, err
+		}
+		err = generatePk(hood.Dialect, model)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range model.Fields {
+			switch f.Value.(type) {
+			case Created, Updated:
+				f.Value = now
+			}
+		}
+		rows = append(rows, row)
+		models = append(models, model)
+	}
+	ids := make([]interface{}, 0, len(models))
+	if len(models) == 0 {
+		return ids, nil
+	}
+	m := 0
+	columns, _, _ := columnsMarkersAndValuesForModel(hood.Dialect, models[0], &m, true)
+	batchSize := hood.Dialect.MaxInsertRows(len(columns))
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	err := hood.Transaction(func(tx *Hood) error {
+		for start := 0; start < len(models); start += batchSize {
+			end := start + batchSize
+			if end > len(models) {
+				end = len(models)
+			}
+			batchIds, err := tx.Dialect.InsertAll(tx, models[start:end])
+			// inserts may not be executed with Exec, e.g. to return the ids
+			err = tx.Dialect.ConvertError(err)
+			if err != nil {
+				return err
+			}
+			for i, id := range batchIds {
+				row := rows[start+i]
+				setSavedFields(row, models[start+i], id, now, false)
+				err = callModelMethod(row, "AfterInsert", false)
+				if err != nil {
+					return err
+				}
+				err = callModelMethod(row, "AfterSave", false)
+				if err != nil {
+					return err
+				}
+			}
+			ids = append(ids, batchIds...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// Delete deletes the row matching the specified structs primary key.
+func (hood *Hood) Delete(f interface{}) (interface{}, error) {
 	model, err := interfaceToModel(f)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
 	err = callModelMethod(f, "BeforeDelete", false)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
 	if model.Pk == nil {
-		panic("no primary key field")
+		return nil, ErrNoPrimaryKey
 	}
 	id, err := hood.Dialect.Delete(hood, model)
 	if err != nil {
-		return -1, err
+		return nil, err
 	}
 	return id, callModelMethod(f, "AfterDelete", false)
 }
 
-// DeleteAll deletes the rows matching the specified struct slice Ids.
-func (hood *Hood) DeleteAll(f interface{}) ([]Id, error) {
-	return hood.doAll(f, func(f2 interface{}) (Id, error) {
+// DeleteAll deletes the rows matching the primary keys of the specified struct
+// slice.
+func (hood *Hood) DeleteAll(f interface{}) ([]interface{}, error) {
+	return hood.doAll(f, func(f2 interface{}) (interface{}, error) {
 		return hood.Delete(f2)
 	})
 }
 
-// DeleteFrom deletes the rows matched by the previous Where clause. table can
-// either be a table struct or a string.
-//
-// Example:
-//
-//    hd.Where("amount", "=", 0).DeleteFrom("stock")
-//
-func (hood *Hood) DeleteFrom(table interface{}) error {
-	defer hood.Reset()
-	return hood.Dialect.DeleteFrom(hood, tableName(table))
-}
-
 // CreateTable creates a new table based on the provided schema.
 func (hood *Hood) CreateTable(table interface{}) error {
 	return hood.createTable(table, false)
@@ -1019,25 +1805,54 @@ func (hood *Hood) CreateTableIfNotExists(table interface{}) error {
 
 func (hood *Hood) createTable(table interface{}, ifNotExists bool) error {
 	if !hood.dryRun && !hood.IsTransaction() {
-		panic("CreateTable can only be invoked inside a transaction")
+		return ErrNotInTransaction
 	}
 	model, err := interfaceToModel(table)
 	if err != nil {
 		return err
 	}
-	hood.schema = append(hood.schema, model)
-	if hood.dryRun {
-		return nil
+	joins, err := manyToManyFields(reflect.Indirect(reflect.ValueOf(table)).Type())
+	if err != nil {
+		return err
 	}
-	if ifNotExists {
-		hood.Dialect.CreateTableIfNotExists(hood, model)
-	} else {
-		hood.Dialect.CreateTable(hood, model)
+	joinModels := make([]*Model, 0, len(joins))
+	for _, j := range joins {
+		joinModels = append(joinModels, j.model(nil, nil))
 	}
-	for _, i := range model.Indexes {
-		hood.Dialect.CreateIndex(hood, i.Name, model.Table, i.Unique, i.Columns...)
+	if !hood.dryRun {
+		if ifNotExists {
+			err = hood.Dialect.CreateTableIfNotExists(hood, model)
+		} else {
+			err = hood.Dialect.CreateTable(hood, model)
+		}
+		if err != nil {
+			return err
+		}
+		for _, i := range model.Indexes {
+			err = hood.Dialect.CreateIndex(hood, i.Name, model.Table, i.Unique, i.Columns...)
+			if err != nil {
+				return err
+			}
+		}
+		// join tables are shared by both sides of the association
+		for _, m := range joinModels {
+			err = hood.Dialect.CreateTableIfNotExists(hood, m)
+			if err != nil {
+				return err
+			}
+		}
+		err = hood.firstError()
+		if err != nil {
+			return err
+		}
 	}
-	return hood.firstTxError
+	hood.schema = append(hood.schema, model)
+	for _, m := range joinModels {
+		if !hood.schema.hasTable(m.Table) {
+			hood.schema = append(hood.schema, m)
+		}
+	}
+	return nil
 }
 
 // DropTable drops the table matching the provided table name.
@@ -1051,9 +1866,13 @@ func (hood *Hood) DropTableIfExists(table interface{}) error {
 }
 
 func (hood *Hood) dropTable(table interface{}, ifExists bool) error {
+	tn, err := tableName(table)
+	if err != nil {
+		return err
+	}
 	s := []*Model{}
 	for _, m := range hood.schema {
-		if m.Table != tableName(table) {
+		if m.Table != tn {
 			s = append(s, m)
 		}
 	}
@@ -1062,38 +1881,50 @@ func (hood *Hood) dropTable(table interface{}, ifExists bool) error {
 		return nil
 	}
 	if ifExists {
-		return hood.Dialect.DropTableIfExists(hood, tableName(table))
+		return hood.Dialect.DropTableIfExists(hood, tn)
 	}
-	return hood.Dialect.DropTable(hood, tableName(table))
+	return hood.Dialect.DropTable(hood, tn)
 }
 
 // RenameTable renames a table. The arguments can either be a schema definition
 // or plain strings.
 func (hood *Hood) RenameTable(from, to interface{}) error {
+	fromName, err := tableName(from)
+	if err != nil {
+		return err
+	}
+	toName, err := tableName(to)
+	if err != nil {
+		return err
+	}
 	for _, m := range hood.schema {
-		if m.Table == tableName(from) {
-			m.Table = tableName(to)
+		if m.Table == fromName {
+			m.Table = toName
 		}
 	}
 	if hood.dryRun {
 		return nil
 	}
-	return hood.Dialect.RenameTable(hood, tableName(from), tableName(to))
+	return hood.Dialect.RenameTable(hood, fromName, toName)
 }
 
 // AddColumns adds the columns in the specified schema to the table.
 func (hood *Hood) AddColumns(table, columns interface{}) error {
 	if !hood.dryRun && !hood.IsTransaction() {
-		panic("AddColumns can only be invoked inside a transaction")
+		return ErrNotInTransaction
 	}
 	m, err := interfaceToModel(columns)
 	if err != nil {
 		return err
 	}
+	tn, err := tableName(table)
+	if err != nil {
+		return err
+	}
 	for _, s := range hood.schema {
-		if s.Table == tableName(table) {
+		if s.Table == tn {
 			if m.Pk != nil {
-				panic("primary keys can only be specified on table create (for now)")
+				return errors.New("primary keys can only be specified on table create (for now)")
 			}
 			s.Fields = append(s.Fields, m.Fields...)
 		}
@@ -1102,18 +1933,22 @@ func (hood *Hood) AddColumns(table, columns interface{}) error {
 		return nil
 	}
 	for _, column := range m.Fields {
-		err = hood.Dialect.AddColumn(hood, tableName(table), column.Name, column.Value, column.Size())
+		err = hood.Dialect.AddColumn(hood, tn, column.Name, column.sqlValue(), column.Size(), column.ForeignKey(tn))
 		if err != nil {
 			return err
 		}
 	}
-	return hood.firstTxError
+	return hood.firstError()
 }
 
 // RenameColumn renames the column in the specified table.
 func (hood *Hood) RenameColumn(table interface{}, from, to string) error {
+	tn, err := tableName(table)
+	if err != nil {
+		return err
+	}
 	for _, s := range hood.schema {
-		if s.Table == tableName(table) {
+		if s.Table == tn {
 			for _, f := range s.Fields {
 				if f.Name == from {
 					f.Name = to
@@ -1124,20 +1959,24 @@ func (hood *Hood) RenameColumn(table interface{}, from, to string) error {
 	if hood.dryRun {
 		return nil
 	}
-	return hood.Dialect.RenameColumn(hood, tableName(table), from, to)
+	return hood.Dialect.RenameColumn(hood, tn, from, to)
 }
 
 // ChangeColumn changes the data type of the specified column.
 func (hood *Hood) ChangeColumns(table, column interface{}) error {
 	if !hood.dryRun && !hood.IsTransaction() {
-		panic("ChangeColumns can only be invoked inside a transaction")
+		return ErrNotInTransaction
 	}
 	m, err := interfaceToModel(column)
 	if err != nil {
 		return err
 	}
+	tn, err := tableName(table)
+	if err != nil {
+		return err
+	}
 	for _, s := range hood.schema {
-		if s.Table == tableName(table) {
+		if s.Table == tn {
 			fields := []*ModelField{}
 			for _, oldField := range s.Fields {
 				for _, newField := range m.Fields {
@@ -1155,25 +1994,29 @@ func (hood *Hood) ChangeColumns(table, column interface{}) error {
 		return nil
 	}
 	for _, column := range m.Fields {
-		err = hood.Dialect.ChangeColumn(hood, tableName(table), column.Name, column.Value, column.Size())
+		err = hood.Dialect.ChangeColumn(hood, tn, column.Name, column.sqlValue(), column.Size())
 		if err != nil {
 			return err
 		}
 	}
-	return hood.firstTxError
+	return hood.firstError()
 }
 
 // RemoveColumns removes the specified columns from the table.
 func (hood *Hood) RemoveColumns(table, columns interface{}) error {
 	if !hood.dryRun && !hood.IsTransaction() {
-		panic("RemoveColumns can only be invoked inside a transaction")
+		return ErrNotInTransaction
 	}
 	m, err := interfaceToModel(columns)
 	if err != nil {
 		return err
 	}
+	tn, err := tableName(table)
+	if err != nil {
+		return err
+	}
 	for _, s := range hood.schema {
-		if s.Table == tableName(table) {
+		if s.Table == tn {
 			fields := []*ModelField{}
 			for _, field := range s.Fields {
 				remove := false
@@ -1194,20 +2037,23 @@ func (hood *Hood) RemoveColumns(table, columns interface{}) error {
 		return nil
 	}
 	for _, column := range m.Fields {
-		err = hood.Dialect.DropColumn(hood, tableName(table), column.Name)
+		err = hood.Dialect.DropColumn(hood, tn, column.Name)
 		if err != nil {
 			return err
 		}
 	}
-	return hood.firstTxError
+	return hood.firstError()
 }
 
 // CreateIndex creates the specified index on table.
 func (hood *Hood) CreateIndex(table interface{}, name string, unique bool, columns ...string) error {
 	if !hood.dryRun && !hood.IsTransaction() {
-		panic("CreateIndex can only be invoked inside a transaction")
+		return ErrNotInTransaction
+	}
+	tn, err := tableName(table)
+	if err != nil {
+		return err
 	}
-	tn := tableName(table)
 	index := &Index{Name: name, Columns: columns, Unique: unique}
 	for _, s := range hood.schema {
 		if s.Table == tn {
@@ -1217,16 +2063,19 @@ func (hood *Hood) CreateIndex(table interface{}, name string, unique bool, colum
 	if hood.dryRun {
 		return nil
 	}
-	err := hood.Dialect.CreateIndex(hood, index.Name, tn, index.Unique, index.Columns...)
+	err = hood.Dialect.CreateIndex(hood, index.Name, tn, index.Unique, index.Columns...)
 	if err != nil {
 		return err
 	}
-	return hood.firstTxError
+	return hood.firstError()
 }
 
 // DropIndex drops the specified index from table.
 func (hood *Hood) DropIndex(table interface{}, name string) error {
-	tn := tableName(table)
+	tn, err := tableName(table)
+	if err != nil {
+		return err
+	}
 	for _, s := range hood.schema {
 		if s.Table == tn {
 			indexes := []*Index{}
@@ -1244,13 +2093,75 @@ func (hood *Hood) DropIndex(table interface{}, name string) error {
 	return hood.Dialect.DropIndex(hood, name)
 }
 
-func (hood *Hood) substituteMarkers(query string) string {
+// AddForeignKey adds the foreign key constraint on fk.Column to table. Its name
+// is set to '<table>_<column>_fkey', e.g.
+//
+//   tx.AddForeignKey(&Post{}, &hood.ForeignKey{Column: "user_id", RefTable: "users", RefColumn: "id", OnDelete: "cascade"})
+func (hood *Hood) AddForeignKey(table interface{}, fk *ForeignKey) error {
+	if !hood.dryRun && !hood.IsTransaction() {
+		return ErrNotInTransaction
+	}
+	tn, err := tableName(table)
+	if err != nil {
+		return err
+	}
+	fk.Name = foreignKeyName(tn, fk.Column)
+	hood.setSchemaForeignKey(tn, fk.Column, fk)
+	if hood.dryRun {
+		return nil
+	}
+	err = hood.Dialect.AddForeignKey(hood, tn, fk)
+	if err != nil {
+		return err
+	}
+	return hood.firstError()
+}
+
+// DropForeignKey drops the foreign key constraint on column from table.
+func (hood *Hood) DropForeignKey(table interface{}, column string) error {
+	if !hood.dryRun && !hood.IsTransaction() {
+		return ErrNotInTransaction
+	}
+	tn, err := tableName(table)
+	if err != nil {
+		return err
+	}
+	hood.setSchemaForeignKey(tn, column, nil)
+	if hood.dryRun {
+		return nil
+	}
+	err = hood.Dialect.DropForeignKey(hood, tn, foreignKeyName(tn, column))
+	if err != nil {
+		return err
+	}
+	return hood.firstError()
+}
+
+// setSchemaForeignKey tracks fk in the schema by setting the tags of column.
+func (hood *Hood) setSchemaForeignKey(table, column string, fk *ForeignKey) {
+	for _, s := range hood.schema {
+		if s.Table == table {
+			for _, field := range s.Fields {
+				if field.Name == column {
+					field.setForeignKey(fk)
+				}
+			}
+		}
+	}
+}
+
+func foreignKeyName(table, column string) string {
+	return table + "_" + column + "_fkey"
+}
+
+func substituteMarkers(d Dialect, query string) string {
 	// in order to use a uniform marker syntax, substitute
 	// all question marks with the dialect marker
+	pos := 0
 	chunks := make([]string, 0, len(query)*2)
 	for _, v := range query {
 		if v == '?' {
-			chunks = append(chunks, hood.Dialect.NextMarker(&hood.markerPos))
+			chunks = append(chunks, d.NextMarker(&pos))
 		} else {
 			chunks = append(chunks, string(v))
 		}
@@ -1284,6 +2195,9 @@ func addFields(m *Model, t reflect.Type, v reflect.Value) {
 			continue
 		}
 		parsedSqlTags := parseTags(sqlTag)
+		if isAssociation(parsedSqlTags) {
+			continue
+		}
 		rawValidateTag := field.Tag.Get("validate")
 		parsedValidateTags := make(map[string]string)
 		if len(rawValidateTag) > 0 {
@@ -1301,7 +2215,10 @@ func addFields(m *Model, t reflect.Type, v reflect.Value) {
 			RawTag:       field.Tag,
 		}
 		if fd.PrimaryKey() {
-			m.Pk = fd
+			if m.Pk == nil {
+				m.Pk = fd
+			}
+			m.Pks = append(m.Pks, fd)
 		}
 		m.Fields = append(m.Fields, fd)
 	}
@@ -1330,14 +2247,18 @@ func interfaceToModel(f interface{}) (*Model, error) {
 	return m, nil
 }
 
-func tableName(f interface{}) string {
-	switch t := f.(type) {
-	case string:
-		return t
+// tableName returns the table name of f, which is either the name itself, or
+// a struct, or a pointer to, or a slice of structs.
+func tableName(f interface{}) (string, error) {
+	if s, ok := f.(string); ok {
+		return s, nil
+	}
+	t := reflect.TypeOf(f)
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
 	}
-	m, _ := interfaceToModel(f)
-	if m != nil {
-		return m.Table
+	if t == nil || t.Kind() != reflect.Struct {
+		return "", ErrInvalidTable
 	}
-	panic("invalid table name")
+	return interfaceToSnake(f), nil
 }
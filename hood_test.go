@@ -1,6 +1,8 @@
 package hood
 
 import (
+	"database/sql"
+	"net"
 	"strings"
 	"testing"
 	"time"
@@ -56,6 +58,163 @@ func TestFieldZero(t *testing.T) {
 	}
 }
 
+func TestWhereOperatorErrors(t *testing.T) {
+	type user struct {
+		Id Id
+	}
+	hd := New(nil, NewPostgres())
+	var out []user
+	err := hd.Where("id", "~", 1).Find(&out)
+	if err == nil || err.Error() != "invalid operator '~'" {
+		t.Fatal("wrong error", err)
+	}
+	if q := hd.Where("id", "=", 1); q.err != nil {
+		t.Fatal("error leaked into new query", q.err)
+	}
+	err = hd.Where("id", "IN", 1).Find(&out)
+	if err == nil {
+		t.Fatal("should fail on non-slice IN value")
+	}
+	err = hd.Where("id", "BETWEEN", []int{1, 2, 3}).Find(&out)
+	if err == nil {
+		t.Fatal("should fail on BETWEEN value with three elements")
+	}
+	err = hd.Where("id", "=", 1).OrGroup(func(c *Cond) {
+		c.Where("id", "IS NULL", nil).And("id", "=>", 2)
+	}).Find(&out)
+	if err == nil || err.Error() != "invalid operator '=>'" {
+		t.Fatal("wrong error", err)
+	}
+	err = hd.Where("id", "NOT BETWEEN", "a").DeleteFrom(&user{})
+	if err == nil {
+		t.Fatal("should fail on non-slice NOT BETWEEN value")
+	}
+}
+
+func TestQueryIsImmutable(t *testing.T) {
+	hd := New(nil, NewPostgres())
+	base := hd.Select("users").Where("a", "=", 1).And("b", "=", 2)
+	q1 := base.And("c", "=", 3).OrderBy("c")
+	q2 := base.Or("d", "=", 4).Limit(5)
+
+	tests := []struct {
+		q   *Query
+		sql string
+	}{
+		{base, `SELECT * FROM "users" WHERE "a" = $1 AND "b" = $2`},
+		{q1, `SELECT * FROM "users" WHERE "a" = $1 AND "b" = $2 AND "c" = $3 ORDER BY "c"`},
+		{q2, `SELECT * FROM "users" WHERE "a" = $1 AND "b" = $2 OR "d" = $3 LIMIT $4`},
+	}
+	for _, test := range tests {
+		if sql, _ := hd.Dialect.QuerySql(test.q); sql != test.sql {
+			t.Fatalf("invalid query:\n%s\n---should be---\n%s\n", sql, test.sql)
+		}
+	}
+}
+
+func TestFindSqlInvalidOut(t *testing.T) {
+	hd := New(nil, NewPostgres())
+	for _, out := range []interface{}{nil, 1, []string{}, new(int), (*[]string)(nil)} {
+		err := hd.FindSql(out, "SELECT 1")
+		if err == nil {
+			t.Fatalf("should fail on %T", out)
+		}
+	}
+	_, err := hd.Where("id", "=", 1).FindMaps()
+	if err == nil {
+		t.Fatal("should fail without table")
+	}
+	var names []string
+	err = hd.Where("id", "=", 1).Pluck("name", &names)
+	if err == nil {
+		t.Fatal("should fail without table")
+	}
+}
+
+func TestErrorsInsteadOfPanics(t *testing.T) {
+	hd := New(nil, NewPostgres())
+	type noPk struct {
+		Name string
+	}
+	if _, err := hd.Save(&noPk{}); err != ErrNoPrimaryKey {
+		t.Fatal("wrong error", err)
+	}
+	if _, err := hd.Delete(&noPk{}); err != ErrNoPrimaryKey {
+		t.Fatal("wrong error", err)
+	}
+	if _, err := hd.SaveAll(noPk{}); err == nil {
+		t.Fatal("should fail on non-slice")
+	}
+	if err := hd.CreateTable(&noPk{}); err != ErrNotInTransaction {
+		t.Fatal("wrong error", err)
+	}
+	if err := hd.AddColumns("no_pk", &noPk{}); err != ErrNotInTransaction {
+		t.Fatal("wrong error", err)
+	}
+	type badLen struct {
+		Name string `validate:"len(3)"`
+	}
+	if err := hd.Validate(&badLen{Name: "abc"}); err == nil {
+		t.Fatal("should fail on malformed len tag")
+	}
+	type badRange struct {
+		Age int `validate:"range(a:5)"`
+	}
+	if err := hd.Validate(&badRange{Age: 3}); err == nil {
+		t.Fatal("should fail on malformed range tag")
+	}
+	if err := hd.Limit(1).DeleteFrom("no_pk"); err != ErrNoWhereClause {
+		t.Fatal("wrong error", err)
+	}
+	if err := hd.DropTable(42); err != ErrInvalidTable {
+		t.Fatal("wrong error", err)
+	}
+	if err := hd.RenameTable("no_pk", 42); err != ErrInvalidTable {
+		t.Fatal("wrong error", err)
+	}
+	if err := hd.Where("id", "=", 1).DeleteFrom(42); err != ErrInvalidTable {
+		t.Fatal("wrong error", err)
+	}
+	var out []noPk
+	if err := hd.Join(InnerJoin, 42, "a.id", "b.id").Find(&out); err != ErrInvalidTable {
+		t.Fatal("wrong error", err)
+	}
+	if err := hd.Select(nil).Find(&out); err != ErrInvalidTable {
+		t.Fatal("wrong error", err)
+	}
+	if err := hd.Select(42).Find(&out); err != ErrInvalidTable {
+		t.Fatal("wrong error", err)
+	}
+	if _, err := hd.Where("id", "=", 1).Count(42); err != ErrInvalidTable {
+		t.Fatal("wrong error", err)
+	}
+	tx := Dry()
+	if err := tx.CreateIndex(42, "name_index", false, "name"); err != ErrInvalidTable {
+		t.Fatal("wrong error", err)
+	}
+}
+
+func TestGoSchemaImports(t *testing.T) {
+	type schemaImports struct {
+		Id      Id
+		Address net.IP
+		Created time.Time
+		Name    *string
+		Age     sql.NullInt64
+	}
+	hd := Dry()
+	hd.CreateTable(&schemaImports{})
+	x := hd.GoSchema()
+	if !strings.Contains(x, "import (\n\t\"github.com/eaigner/hood\"\n\t\"database/sql\"\n\t\"net\"\n\t\"time\"\n)") {
+		t.Fatal("wrong imports", x)
+	}
+	for _, decl := range []string{"Address\tnet.IP", "Name\t*string", "Age\tsql.NullInt64"} {
+		if !strings.Contains(x, decl) {
+			t.Fatal("wrong declaration", x)
+		}
+	}
+}
+
 func TestFieldValidate(t *testing.T) {
 	type Schema struct {
 		A string `validate:"len(3:6)"`
@@ -240,9 +399,15 @@ func TestInterfaceToModel(t *testing.T) {
 	if m.Pk == nil {
 		t.Fatal("pk nil")
 	}
-	if m.Pk.Name != "col_alt_primary" {
+	if m.Pk.Name != "col_primary" {
 		t.Fatal("wrong value", m.Pk.Name)
 	}
+	if x := m.Pks; len(x) != 2 || x[0] != m.Pk || x[1].Name != "col_alt_primary" {
+		t.Fatal("wrong composite key", x)
+	}
+	if x := m.PkValue().([]interface{}); x[0] != Id(6) || x[1] != "banana" {
+		t.Fatal("wrong key value", x)
+	}
 	if x := len(m.Fields); x != 5 {
 		t.Fatal("wrong value", x)
 	}
@@ -465,3 +630,103 @@ func TestSchemaGeneration(t *testing.T) {
 		t.Fatalf("invalid schema\n%s\n\n%s", makeWhitespaceVisible(x), makeWhitespaceVisible(decl9))
 	}
 }
+
+func TestUUID(t *testing.T) {
+	u, err := NewUUID()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if u == (UUID{}) {
+		t.Fatal("uuid not generated")
+	}
+	if x := u[6] >> 4; x != 4 {
+		t.Fatal("wrong version", x)
+	}
+	s := u.String()
+	if len(s) != 36 || s[14] != '4' {
+		t.Fatal("wrong string", s)
+	}
+	p, err := ParseUUID(s)
+	if err != nil || p != u {
+		t.Fatal("wrong parsed uuid", p, err)
+	}
+	for _, invalid := range []string{"", "abc", strings.Replace(s, "-", "x", 1), "zz" + s[2:]} {
+		if _, err := ParseUUID(invalid); err == nil {
+			t.Fatal("error nil for", invalid)
+		}
+	}
+	var scanned UUID
+	for _, src := range []interface{}{s, []byte(s), u[:]} {
+		scanned = UUID{}
+		if err := scanned.Scan(src); err != nil || scanned != u {
+			t.Fatal("wrong scanned uuid", src, scanned, err)
+		}
+	}
+	if err := scanned.Scan(nil); err != nil || scanned != (UUID{}) {
+		t.Fatal("NULL not scanned as zero uuid", scanned, err)
+	}
+	if x, _ := u.Value(); x != s {
+		t.Fatal("wrong value", x)
+	}
+}
+
+func TestForeignKeySchemaGeneration(t *testing.T) {
+	type Posts struct {
+		Id       Id
+		UserId   int64 `sql:"references(users.id),ondelete(cascade)" validate:"presence"`
+		EditorId int64 `sql:"notnull"`
+	}
+	hd := Dry()
+	hd.CreateTable(&Posts{})
+	m := hd.schema[0]
+	fks := m.ForeignKeys()
+	if len(fks) != 1 {
+		t.Fatal("wrong foreign key count", len(fks))
+	}
+	want := ForeignKey{Name: "posts_user_id_fkey", Column: "user_id", RefTable: "users", RefColumn: "id", OnDelete: "cascade"}
+	if *fks[0] != want {
+		t.Fatal("wrong foreign key", fks[0])
+	}
+	hd.AddForeignKey(&Posts{}, &ForeignKey{Column: "editor_id", RefTable: "users", RefColumn: "id", OnDelete: "set null"})
+	hd.DropForeignKey(&Posts{}, "user_id")
+	decl := "type Posts struct {\n" +
+		"\tId\thood.Id\n" +
+		"\tUserId\tint64\t`validate:\"presence\"`\n" +
+		"\tEditorId\tint64\t`sql:\"notnull,references(users.id),ondelete(set null)\"`\n" +
+		"}"
+	if x := hd.schema.GoDeclaration(); x != decl {
+		t.Fatalf("invalid schema\n%s\n---\n%s", makeWhitespaceVisible(x), makeWhitespaceVisible(decl))
+	}
+	fks = m.ForeignKeys()
+	if len(fks) != 1 || fks[0].Name != "posts_editor_id_fkey" || fks[0].OnDelete != "set null" {
+		t.Fatal("wrong foreign keys", fks)
+	}
+}
+
+func TestManyToManySchemaGeneration(t *testing.T) {
+	type Roles struct {
+		Id   Id
+		Name string
+	}
+	type Users struct {
+		Id    Id
+		Roles []Roles `sql:"many_to_many(user_roles)"`
+	}
+	hd := Dry()
+	hd.CreateTable(&Users{})
+	hd.CreateTable(&Roles{})
+	decl := "type Users struct {\n" +
+		"\tId\thood.Id\n" +
+		"}\n\n" +
+		"type UserRoles struct {\n" +
+		"\tUsersId\tint64\t`sql:\"pk\"`\n" +
+		"\tRolesId\tint64\t`sql:\"pk\"`\n" +
+		"}\n\n" +
+		"type Roles struct {\n" +
+		"\tId\thood.Id\n" +
+		"\tName\tstring\n" +
+		"}"
+	if x := hd.schema.GoDeclaration(); x != decl {
+		t.Fatalf("invalid schema\n%s\n---\n%s", makeWhitespaceVisible(x), makeWhitespaceVisible(decl))
+	}
+}
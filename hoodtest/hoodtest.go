@@ -0,0 +1,325 @@
+// Package hoodtest provides an in-memory database driver and dialect for unit
+// testing code that uses hood without a database.
+//
+// Like hood.Dry, a Hood returned by Open does not touch a real database. But
+// instead of only tracking schema changes, every statement hood sends to the
+// driver is recorded together with its arguments, and results can be queued
+// up in advance:
+//
+//	hd, rec := hoodtest.Open(hood.NewPostgres())
+//	rec.QueueRows([]string{"id", "name"}, []interface{}{1, "banana"})
+//
+//	var fruits []Fruit
+//	err := hd.Where("name", "=", "banana").Find(&fruits)
+//
+//	rec.Statements()[0].Query // SELECT * FROM "fruit" WHERE "name" = $1
+package hoodtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/eaigner/hood"
+	"io"
+	"reflect"
+	"sync"
+)
+
+type (
+	// Statement is a statement that was sent to the driver.
+	Statement struct {
+		Query string
+		Args  []interface{}
+	}
+
+	// Recorder records the statements of a Hood returned by Open and holds the
+	// queued results.
+	Recorder struct {
+		mutex        sync.Mutex
+		statements   []Statement
+		responses    []*response
+		lastInsertId int64
+	}
+
+	// Dialect generates sql using the wrapped dialect. It retrieves inserted
+	// ids via LastInsertId, which makes inserts work without queued rows, and
+	// accepts queued strings for string fields.
+	Dialect struct {
+		hood.Dialect
+	}
+
+	response struct {
+		columns      []string
+		rows         [][]interface{}
+		lastInsertId int64
+		rowsAffected int64
+		isResult     bool
+		err          error
+	}
+
+	connector struct {
+		rec *Recorder
+	}
+
+	conn struct {
+		rec *Recorder
+	}
+
+	stmt struct {
+		rec   *Recorder
+		query string
+	}
+
+	tx struct {
+		rec *Recorder
+	}
+
+	rows struct {
+		columns []string
+		rows    [][]interface{}
+		pos     int
+	}
+
+	result struct {
+		lastInsertId int64
+		rowsAffected int64
+	}
+)
+
+// Open returns a Hood backed by the in-memory driver, generating sql with the
+// specified dialect, and the Recorder for it.
+func Open(dialect hood.Dialect) (*hood.Hood, *Recorder) {
+	rec := &Recorder{}
+	db := sql.OpenDB(&connector{rec})
+	return hood.New(db, &Dialect{dialect}), rec
+}
+
+// Statements returns all statements recorded so far. Transactions are recorded
+// as BEGIN, COMMIT and ROLLBACK statements. A BEGIN with transaction options
+// has the isolation level and read-only flag as arguments.
+func (rec *Recorder) Statements() []Statement {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	return append([]Statement{}, rec.statements...)
+}
+
+// Reset clears the recorded statements and queued results.
+func (rec *Recorder) Reset() {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	rec.statements = nil
+	rec.responses = nil
+}
+
+// QueueRows queues rows that are returned by the next statement. Each queued
+// result is consumed by exactly one statement. If nothing is queued, queries
+// return no rows.
+func (rec *Recorder) QueueRows(columns []string, rows ...[]interface{}) {
+	rec.queue(&response{columns: columns, rows: rows})
+}
+
+// QueueResult queues the result of the next statement. If nothing is queued,
+// statements affect one row and return auto-incrementing insert ids.
+func (rec *Recorder) QueueResult(lastInsertId, rowsAffected int64) {
+	rec.queue(&response{
+		lastInsertId: lastInsertId,
+		rowsAffected: rowsAffected,
+		isResult:     true,
+	})
+}
+
+// QueueError queues an error that is returned by the next statement.
+func (rec *Recorder) QueueError(err error) {
+	rec.queue(&response{err: err})
+}
+
+func (rec *Recorder) queue(r *response) {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	rec.responses = append(rec.responses, r)
+}
+
+// record records the statement and returns the next queued response, or an
+// empty response if nothing is queued.
+func (rec *Recorder) record(query string, args []driver.Value) *response {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	a := make([]interface{}, 0, len(args))
+	for _, v := range args {
+		a = append(a, v)
+	}
+	rec.statements = append(rec.statements, Statement{query, a})
+	if len(rec.responses) == 0 {
+		return &response{}
+	}
+	r := rec.responses[0]
+	rec.responses = rec.responses[1:]
+	return r
+}
+
+// result returns the queued result of r, or the default result if nothing was
+// queued.
+func (rec *Recorder) result(r *response) *result {
+	if r.isResult {
+		return &result{r.lastInsertId, r.rowsAffected}
+	}
+	if r.columns != nil {
+		return &result{rowsAffected: int64(len(r.rows))}
+	}
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+	rec.lastInsertId++
+	return &result{rec.lastInsertId, 1}
+}
+
+func (d *Dialect) Insert(hd *hood.Hood, model *hood.Model) (interface{}, error) {
+	sql, args := d.InsertSql(model)
+	result, err := hd.Exec(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	if !model.AutoIncrement() {
+		return model.PkValue(), nil
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return hood.Id(id), nil
+}
+
+func (d *Dialect) InsertAll(hd *hood.Hood, models []*hood.Model) ([]interface{}, error) {
+	sql, args := d.InsertAllSql(models)
+	result, err := hd.Exec(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	var first int64
+	if models[0].AutoIncrement() {
+		// the last insert id is the id of the first row, like on MySQL
+		first, err = result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+	}
+	ids := make([]interface{}, 0, len(models))
+	for i, model := range models {
+		if model.AutoIncrement() {
+			ids = append(ids, hood.Id(first+int64(i)))
+		} else {
+			ids = append(ids, model.PkValue())
+		}
+	}
+	return ids, nil
+}
+
+func (d *Dialect) SetModelValue(driverValue, fieldValue reflect.Value) error {
+	if s, ok := driverValue.Interface().(string); ok {
+		var v interface{} = []byte(s)
+		driverValue = reflect.ValueOf(&v).Elem()
+	}
+	return d.Dialect.SetModelValue(driverValue, fieldValue)
+}
+
+func (c *connector) Connect(_ context.Context) (driver.Conn, error) {
+	return &conn{c.rec}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c
+}
+
+func (c *connector) Open(name string) (driver.Conn, error) {
+	return &conn{c.rec}, nil
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{c.rec, query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(_ context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var args []driver.Value
+	if opts != (driver.TxOptions{}) {
+		args = []driver.Value{sql.IsolationLevel(opts.Isolation).String(), opts.ReadOnly}
+	}
+	if r := c.rec.record("BEGIN", args); r.err != nil {
+		return nil, r.err
+	}
+	return &tx{c.rec}, nil
+}
+
+func (t *tx) Commit() error {
+	return t.rec.record("COMMIT", nil).err
+}
+
+func (t *tx) Rollback() error {
+	return t.rec.record("ROLLBACK", nil).err
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	r := s.rec.record(s.query, args)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return s.rec.result(r), nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	r := s.rec.record(s.query, args)
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &rows{columns: r.columns, rows: r.rows}, nil
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	row := r.rows[r.pos]
+	r.pos++
+	if len(row) != len(dest) {
+		return errors.New("hoodtest: queued row does not match column count")
+	}
+	for i, v := range row {
+		x, err := driver.DefaultParameterConverter.ConvertValue(v)
+		if err != nil {
+			return err
+		}
+		dest[i] = x
+	}
+	return nil
+}
+
+func (r *result) LastInsertId() (int64, error) {
+	return r.lastInsertId, nil
+}
+
+func (r *result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
@@ -0,0 +1,693 @@
+package hoodtest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/eaigner/hood"
+	"github.com/lib/pq"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fruit struct {
+	Id    hood.Id
+	Name  string
+	Color string
+}
+
+func mustBegin(t *testing.T, hd *hood.Hood) *hood.Hood {
+	tx, err := hd.Begin()
+	if err != nil {
+		t.Fatal("could not begin transaction", err)
+	}
+	return tx
+}
+
+func TestRecordStatements(t *testing.T) {
+	hd, rec := Open(hood.NewPostgres())
+	f := &fruit{Name: "banana", Color: "yellow"}
+	id, err := hd.Save(f)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if id != hood.Id(1) || f.Id != 1 {
+		t.Fatal("wrong id", id, f.Id)
+	}
+	f.Color = "green"
+	_, err = hd.Save(f)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	var out []fruit
+	err = hd.Where("color", "=", "green").Find(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	stmts := rec.Statements()
+	if x := len(stmts); x != 3 {
+		t.Fatal("wrong statement count", x)
+	}
+	if x := stmts[0].Query; x != `INSERT INTO "fruit" ("name", "color") VALUES ($1, $2) RETURNING "id";` {
+		t.Fatal("wrong query", x)
+	}
+	if x := stmts[0].Args; len(x) != 2 || x[0] != "banana" || x[1] != "yellow" {
+		t.Fatal("wrong args", x)
+	}
+	if x := stmts[1].Query; x != `UPDATE "fruit" SET "name" = $1, "color" = $2 WHERE "id" = $3;` {
+		t.Fatal("wrong query", x)
+	}
+	if x := stmts[1].Args; len(x) != 3 || x[2] != int64(1) {
+		t.Fatal("wrong args", x)
+	}
+	if x := stmts[2].Query; x != `SELECT * FROM "fruit" WHERE "color" = $1` {
+		t.Fatal("wrong query", x)
+	}
+	rec.Reset()
+	if x := len(rec.Statements()); x != 0 {
+		t.Fatal("wrong statement count", x)
+	}
+}
+
+func TestNullableFields(t *testing.T) {
+	type nullableFruit struct {
+		Id    hood.Id
+		Name  *string
+		Color sql.NullString
+	}
+	hd, rec := Open(hood.NewPostgres())
+	_, err := hd.Save(&nullableFruit{})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x := rec.Statements()[0].Args; len(x) != 2 || x[0] != nil || x[1] != nil {
+		t.Fatal("wrong args", x)
+	}
+	rec.QueueRows([]string{"id", "name", "color"}, []interface{}{1, nil, "red"})
+	var out nullableFruit
+	err = hd.First(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if out.Name != nil || out.Color != (sql.NullString{String: "red", Valid: true}) {
+		t.Fatal("wrong values", out)
+	}
+}
+
+func TestJsonFields(t *testing.T) {
+	type taggedFruit struct {
+		Id   hood.Id
+		Tags []string `sql:"json"`
+	}
+	hd, rec := Open(hood.NewPostgres())
+	_, err := hd.Save(&taggedFruit{Tags: []string{"sweet", "ripe"}})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x := rec.Statements()[0].Args; len(x) != 1 || x[0] != `["sweet","ripe"]` {
+		t.Fatal("wrong args", x)
+	}
+	rec.QueueRows([]string{"id", "tags"}, []interface{}{1, []byte(`["sour"]`)})
+	var out taggedFruit
+	err = hd.First(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(out.Tags) != 1 || out.Tags[0] != "sour" {
+		t.Fatal("wrong tags", out.Tags)
+	}
+}
+
+func TestUUIDPrimaryKey(t *testing.T) {
+	type taggedFruit struct {
+		Id   hood.UUID `sql:"pk"`
+		Name string
+	}
+	hd, rec := Open(hood.NewPostgres())
+	f := &taggedFruit{Name: "banana"}
+	id, err := hd.Save(f)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if f.Id == (hood.UUID{}) || id != f.Id {
+		t.Fatal("uuid not generated", id, f.Id)
+	}
+	stmts := rec.Statements()
+	if x := stmts[0].Query; x != `INSERT INTO "tagged_fruit" ("id", "name") VALUES ($1, $2);` {
+		t.Fatal("wrong query", x)
+	}
+	if x := stmts[0].Args; len(x) != 2 || x[0] != f.Id.String() {
+		t.Fatal("wrong args", x)
+	}
+	rec.QueueRows([]string{"count"}, []interface{}{1})
+	_, err = hd.Save(f)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	stmts = rec.Statements()
+	if x := stmts[len(stmts)-1].Query; !strings.HasPrefix(x, "UPDATE") {
+		t.Fatal("existing row not updated", x)
+	}
+}
+
+func TestPreload(t *testing.T) {
+	type basketFruit struct {
+		Id       hood.Id
+		BasketId int64
+	}
+	type basket struct {
+		Id     hood.Id
+		Fruits []basketFruit `sql:"has_many(basket_id)"`
+	}
+	hd, rec := Open(hood.NewPostgres())
+	rec.QueueRows([]string{"id"}, []interface{}{1}, []interface{}{2})
+	rec.QueueRows(
+		[]string{"id", "basket_id"},
+		[]interface{}{1, 1},
+		[]interface{}{2, 1},
+	)
+	var out []basket
+	err := hd.Preload("Fruits").Find(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	stmts := rec.Statements()
+	if x := len(stmts); x != 2 {
+		t.Fatal("wrong statement count", x)
+	}
+	if x := stmts[1].Query; x != `SELECT * FROM "basket_fruit" WHERE "basket_id" IN ($1, $2) ORDER BY "id"` {
+		t.Fatal("wrong query", x)
+	}
+	if x := out; len(x) != 2 || len(x[0].Fruits) != 2 || len(x[1].Fruits) != 0 {
+		t.Fatal("wrong value", x)
+	}
+}
+
+func TestPreloadMissingForeignKeyField(t *testing.T) {
+	type basketFruit struct {
+		Id hood.Id
+	}
+	type basket struct {
+		Id     hood.Id
+		Fruits []basketFruit `sql:"has_many(basket_id)"`
+	}
+	hd, rec := Open(hood.NewPostgres())
+	rec.QueueRows([]string{"id"}, []interface{}{1})
+	rec.QueueRows([]string{"id", "basket_id"}, []interface{}{1, 1})
+	var out []basket
+	err := hd.Preload("Fruits").Find(&out)
+	if err == nil || !strings.Contains(err.Error(), "BasketId") {
+		t.Fatal("wrong error", err)
+	}
+	if x := len(rec.Statements()); x != 1 {
+		t.Fatal("wrong statement count", x)
+	}
+}
+
+func TestPreloadChunks(t *testing.T) {
+	type basketFruit struct {
+		Id       hood.Id
+		BasketId int64
+	}
+	type basket struct {
+		Id     hood.Id
+		Fruits []basketFruit `sql:"has_many(basket_id)"`
+	}
+	hd, rec := Open(hood.NewSqlite3())
+	rows := [][]interface{}{}
+	for i := 1; i <= 1000; i++ {
+		rows = append(rows, []interface{}{i})
+	}
+	rec.QueueRows([]string{"id"}, rows...)
+	rec.QueueRows([]string{"id", "basket_id"}, []interface{}{1, 1})
+	rec.QueueRows([]string{"id", "basket_id"}, []interface{}{2, 1000})
+	var out []basket
+	err := hd.Preload("Fruits").Find(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	stmts := rec.Statements()
+	if x := len(stmts); x != 3 {
+		t.Fatal("wrong statement count", x)
+	}
+	if x := len(stmts[1].Args); x != 999 {
+		t.Fatal("wrong argument count", x)
+	}
+	if x := stmts[2].Query; x != `SELECT * FROM "basket_fruit" WHERE "basket_id" IN (?) ORDER BY "id"` {
+		t.Fatal("wrong query", x)
+	}
+	if x := out; len(x[0].Fruits) != 1 || len(x[999].Fruits) != 1 || x[999].Fruits[0].Id != 2 {
+		t.Fatal("wrong value", x[0], x[999])
+	}
+
+	// chunks are limited by parameters, not by the rows of an insert
+	hd, rec = Open(hood.NewMssql())
+	rows = [][]interface{}{}
+	for i := 1; i <= 2000; i++ {
+		rows = append(rows, []interface{}{i})
+	}
+	rec.QueueRows([]string{"id"}, rows...)
+	out = nil
+	err = hd.Preload("Fruits").Find(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	stmts = rec.Statements()
+	if x := len(stmts); x != 2 {
+		t.Fatal("wrong statement count", x)
+	}
+	if x := len(stmts[1].Args); x != 2000 {
+		t.Fatal("wrong argument count", x)
+	}
+}
+
+func TestPreloadManyToManyChunks(t *testing.T) {
+	type role struct {
+		Id   hood.Id
+		Name string
+	}
+	type user struct {
+		Id    hood.Id
+		Roles []*role `sql:"many_to_many(user_roles)"`
+	}
+	hd, rec := Open(hood.NewSqlite3())
+	rows := [][]interface{}{}
+	for i := 1; i <= 1000; i++ {
+		rows = append(rows, []interface{}{i})
+	}
+	rec.QueueRows([]string{"id"}, rows...)
+	rec.QueueRows([]string{"id", "name", "user_id"}, []interface{}{1, "admin", 1})
+	rec.QueueRows([]string{"id", "name", "user_id"}, []interface{}{2, "editor", 1000})
+	var out []user
+	err := hd.Preload("Roles").Find(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	stmts := rec.Statements()
+	if x := len(stmts); x != 3 {
+		t.Fatal("wrong statement count", x)
+	}
+	if x := len(stmts[1].Args); x != 999 {
+		t.Fatal("wrong argument count", x)
+	}
+	if x := len(stmts[2].Args); x != 1 {
+		t.Fatal("wrong argument count", x)
+	}
+	if x := out; len(x[0].Roles) != 1 || len(x[999].Roles) != 1 || x[999].Roles[0].Name != "editor" {
+		t.Fatal("wrong value", x[0], x[999])
+	}
+}
+
+func TestInsertAll(t *testing.T) {
+	hd, rec := Open(hood.NewMysql())
+	fruits := []fruit{{Name: "banana"}, {Name: "apple"}}
+	ids, err := hd.InsertAll(&fruits)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if len(ids) != 2 || ids[1] != hood.Id(2) || fruits[0].Id != 1 || fruits[1].Id != 2 {
+		t.Fatal("wrong ids", ids, fruits)
+	}
+	var inserts []Statement
+	for _, stmt := range rec.Statements() {
+		if strings.HasPrefix(stmt.Query, "INSERT") {
+			inserts = append(inserts, stmt)
+		}
+	}
+	if x := len(inserts); x != 1 {
+		t.Fatal("wrong insert count", x)
+	}
+	if x := inserts[0].Query; x != "INSERT INTO `fruit` (`name`, `color`) VALUES (?, ?), (?, ?);" {
+		t.Fatal("wrong query", x)
+	}
+}
+
+func TestInsertAllIdsByRow(t *testing.T) {
+	// use the dialects themselves, which return the ids with their row number
+	for _, dialect := range []hood.Dialect{hood.NewPostgres(), hood.NewMssql()} {
+		hd, rec := Open(dialect)
+		hd = hood.New(hd.Db, dialect)
+		rec.QueueResult(0, 0) // BEGIN
+		rec.QueueRows([]string{"row", "id"}, []interface{}{1, 11}, []interface{}{0, 10})
+		fruits := []fruit{{Name: "banana"}, {Name: "apple"}}
+		ids, err := hd.InsertAll(&fruits)
+		if err != nil {
+			t.Fatalf("%T: error not nil %v", dialect, err)
+		}
+		if len(ids) != 2 || ids[0] != hood.Id(10) || fruits[0].Id != 10 || fruits[1].Id != 11 {
+			t.Fatalf("%T: wrong ids %v %v", dialect, ids, fruits)
+		}
+	}
+	if x := hood.NewMssql().MaxInsertRows(7); x != 299 {
+		t.Fatal("wrong max insert rows", x)
+	}
+}
+
+func TestCreateTableUnsupportedType(t *testing.T) {
+	type channelModel struct {
+		Id hood.Id
+		Ch chan int
+	}
+	hd, rec := Open(hood.NewPostgres())
+	tx := mustBegin(t, hd)
+	err := tx.CreateTable(&channelModel{})
+	var typeErr *hood.UnsupportedTypeError
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("wrong error %T %v", err, err)
+	}
+	for _, stmt := range rec.Statements() {
+		if strings.HasPrefix(stmt.Query, "CREATE") {
+			t.Fatal("table created", stmt.Query)
+		}
+	}
+	if x := tx.GoSchema(); strings.Contains(x, "ChannelModel") {
+		t.Fatal("table added to schema", x)
+	}
+}
+
+func TestSaveOnlyPrimaryKeys(t *testing.T) {
+	type fruitTag struct {
+		FruitId int64 `sql:"pk"`
+		TagId   int64 `sql:"pk"`
+	}
+	hd, rec := Open(hood.NewPostgres())
+	rec.QueueRows([]string{"count"}, []interface{}{1})
+	_, err := hd.Save(&fruitTag{1, 2})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	for _, stmt := range rec.Statements() {
+		if strings.HasPrefix(stmt.Query, "UPDATE") {
+			t.Fatal("row without non-key columns updated", stmt.Query)
+		}
+	}
+}
+
+func TestQueueRows(t *testing.T) {
+	hd, rec := Open(hood.NewPostgres())
+	rec.QueueRows(
+		[]string{"id", "name", "color"},
+		[]interface{}{1, "banana", "yellow"},
+		[]interface{}{2, "apple", "red"},
+	)
+	var out []fruit
+	err := hd.Find(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x := len(out); x != 2 {
+		t.Fatal("wrong length", x)
+	}
+	if x := out[1]; x.Id != 2 || x.Name != "apple" || x.Color != "red" {
+		t.Fatal("wrong value", x)
+	}
+	out = nil
+	err = hd.Find(&out)
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if out != nil {
+		t.Fatal("output should be nil", out)
+	}
+}
+
+func TestQueueResultAndError(t *testing.T) {
+	hd, rec := Open(hood.NewMysql())
+	rec.QueueResult(42, 1)
+	id, err := hd.Save(&fruit{Name: "pear"})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if id != hood.Id(42) {
+		t.Fatal("wrong id", id)
+	}
+	failure := errors.New("failure")
+	rec.QueueError(failure)
+	_, err = hd.Save(&fruit{Name: "grape"})
+	if err != failure {
+		t.Fatal("wrong error", err)
+	}
+}
+
+func TestConstraintViolation(t *testing.T) {
+	hd, rec := Open(hood.NewPostgres())
+	rec.QueueError(&pq.Error{Code: "23505", Table: "fruit", Constraint: "name_index"})
+	_, err := hd.Save(&fruit{Name: "pear"})
+	var uniqueErr *hood.UniqueViolationError
+	if !errors.As(err, &uniqueErr) {
+		t.Fatal("wrong error", err)
+	}
+	if uniqueErr.Table != "fruit" || uniqueErr.Constraint != "name_index" {
+		t.Fatal("wrong violation", uniqueErr.ConstraintViolation)
+	}
+}
+
+func TestRecordTransaction(t *testing.T) {
+	hd, rec := Open(hood.NewPostgres())
+	tx := mustBegin(t, hd)
+	tx.Save(&fruit{Name: "banana"})
+	err := tx.Commit()
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	stmts := rec.Statements()
+	if x := len(stmts); x != 3 {
+		t.Fatal("wrong statement count", x)
+	}
+	if x := stmts[0].Query; x != "BEGIN" {
+		t.Fatal("wrong query", x)
+	}
+	if x := stmts[2].Query; x != "COMMIT" {
+		t.Fatal("wrong query", x)
+	}
+}
+
+func TestContext(t *testing.T) {
+	hd, rec := Open(hood.NewPostgres())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var out []fruit
+	err := hd.WithContext(ctx).Where("color", "=", "green").Find(&out)
+	if err != context.Canceled {
+		t.Fatal("wrong error", err)
+	}
+	err = hd.Where("color", "=", "green").WithContext(ctx).Find(&out)
+	if err != context.Canceled {
+		t.Fatal("wrong error", err)
+	}
+	_, err = hd.WithContext(ctx).Save(&fruit{Name: "banana"})
+	if err != context.Canceled {
+		t.Fatal("wrong error", err)
+	}
+	if x := len(rec.Statements()); x != 0 {
+		t.Fatal("wrong statement count", x)
+	}
+	if hd.Context() != context.Background() {
+		t.Fatal("context of hd changed")
+	}
+	tx := mustBegin(t, hd.WithContext(context.Background()))
+	_, err = tx.WithContext(ctx).Save(&fruit{Name: "banana"})
+	if err != context.Canceled {
+		t.Fatal("wrong error", err)
+	}
+	if err := tx.Commit(); err != context.Canceled {
+		t.Fatal("commit should report the canceled save", err)
+	}
+}
+
+func TestNestedTransaction(t *testing.T) {
+	hd, rec := Open(hood.NewPostgres())
+	tx := mustBegin(t, hd)
+	inner := mustBegin(t, tx)
+	if err := inner.Rollback(); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	inner = mustBegin(t, tx)
+	if err := mustBegin(t, inner).Commit(); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if err := inner.Commit(); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	want := []string{
+		"BEGIN",
+		`SAVEPOINT "hood_savepoint_1"`,
+		`ROLLBACK TO SAVEPOINT "hood_savepoint_1"`,
+		`SAVEPOINT "hood_savepoint_1"`,
+		`SAVEPOINT "hood_savepoint_2"`,
+		`RELEASE SAVEPOINT "hood_savepoint_2"`,
+		`RELEASE SAVEPOINT "hood_savepoint_1"`,
+		"COMMIT",
+	}
+	stmts := rec.Statements()
+	if x := len(stmts); x != len(want) {
+		t.Fatal("wrong statement count", x, stmts)
+	}
+	for i, stmt := range stmts {
+		if stmt.Query != want[i] {
+			t.Fatal("wrong query", i, stmt.Query)
+		}
+	}
+}
+
+func TestBeginWith(t *testing.T) {
+	hd, rec := Open(hood.NewPostgres())
+	tx, err := hd.BeginWith(hood.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	tx, err = hd.BeginWith(hood.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal("error not nil", err)
+	}
+	stmts := rec.Statements()
+	if x := len(stmts); x != 4 {
+		t.Fatal("wrong statement count", x, stmts)
+	}
+	if x := stmts[0].Args; !reflect.DeepEqual(x, []interface{}{"Repeatable Read", true}) {
+		t.Fatal("wrong options", x)
+	}
+	if x := stmts[2].Args; !reflect.DeepEqual(x, []interface{}{"Serializable", false}) {
+		t.Fatal("wrong options", x)
+	}
+
+	// Nested transactions inherit the options of the outer transaction
+	tx = mustBegin(t, hd)
+	defer tx.Rollback()
+	if _, err := tx.BeginWith(hood.TxOptions{ReadOnly: true}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestBeginError(t *testing.T) {
+	hd, rec := Open(hood.NewPostgres())
+	rec.QueueError(errors.New("no connection"))
+	tx, err := hd.Begin()
+	if err == nil || err.Error() != "no connection" {
+		t.Fatal("wrong error", err)
+	}
+	if tx != nil {
+		t.Fatal("expected nil transaction")
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	hd, rec := Open(hood.NewPostgres())
+	queries := func() []string {
+		a := []string{}
+		for _, stmt := range rec.Statements() {
+			a = append(a, stmt.Query)
+		}
+		rec.Reset()
+		return a
+	}
+
+	err := hd.Transaction(func(tx *hood.Hood) error {
+		_, err := tx.Save(&fruit{Name: "banana"})
+		return err
+	})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if x := queries(); len(x) != 3 || x[0] != "BEGIN" || x[2] != "COMMIT" {
+		t.Fatal("should commit", x)
+	}
+
+	fail := errors.New("fail")
+	err = hd.Transaction(func(tx *hood.Hood) error {
+		return fail
+	})
+	if err != fail {
+		t.Fatal("wrong error", err)
+	}
+	if x := queries(); len(x) != 2 || x[1] != "ROLLBACK" {
+		t.Fatal("should roll back", x)
+	}
+
+	// the error of the insert is ignored by f
+	rec.QueueResult(0, 0)
+	rec.QueueError(fail)
+	err = hd.Transaction(func(tx *hood.Hood) error {
+		tx.Save(&fruit{Name: "banana"})
+		return nil
+	})
+	if err != fail {
+		t.Fatal("wrong error", err)
+	}
+	if x := queries(); len(x) != 3 || x[2] != "ROLLBACK" {
+		t.Fatal("should roll back", x)
+	}
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Fatal("should pass on panic", p)
+			}
+		}()
+		hd.Transaction(func(tx *hood.Hood) error {
+			panic("boom")
+		})
+	}()
+	if x := queries(); len(x) != 2 || x[1] != "ROLLBACK" {
+		t.Fatal("should roll back", x)
+	}
+}
+
+func TestTransactionRetry(t *testing.T) {
+	hd, rec := Open(hood.NewPostgres())
+	deadlock := &pq.Error{Code: "40P01"}
+	rec.QueueResult(0, 0)
+	rec.QueueError(deadlock)
+	calls := 0
+	err := hd.TransactionRetry(2, func(tx *hood.Hood) error {
+		calls++
+		_, err := tx.Save(&fruit{Name: "banana"})
+		return err
+	})
+	if err != nil {
+		t.Fatal("error not nil", err)
+	}
+	if calls != 2 {
+		t.Fatal("wrong call count", calls)
+	}
+	want := []string{"BEGIN", "ROLLBACK", "BEGIN", "COMMIT"}
+	got := []string{}
+	for _, stmt := range rec.Statements() {
+		if stmt.Query == "BEGIN" || stmt.Query == "COMMIT" || stmt.Query == "ROLLBACK" {
+			got = append(got, stmt.Query)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatal("wrong statements", got)
+	}
+
+	// other errors and nested transactions are not retried
+	calls = 0
+	hd.TransactionRetry(2, func(tx *hood.Hood) error {
+		calls++
+		return errors.New("fail")
+	})
+	if calls != 1 {
+		t.Fatal("wrong call count", calls)
+	}
+	calls = 0
+	hd.Transaction(func(tx *hood.Hood) error {
+		return tx.TransactionRetry(2, func(tx *hood.Hood) error {
+			calls++
+			return deadlock
+		})
+	})
+	if calls != 1 {
+		t.Fatal("wrong call count", calls)
+	}
+}
@@ -0,0 +1,319 @@
+package hood
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterDialect("mssql", NewMssql())
+}
+
+type mssql struct {
+	base
+}
+
+func NewMssql() Dialect {
+	d := &mssql{}
+	d.base.Dialect = d
+	return d
+}
+
+func (d *mssql) NextMarker(pos *int) string {
+	m := fmt.Sprintf("@p%d", *pos+1)
+	*pos++
+	return m
+}
+
+func (d *mssql) Quote(s string) string {
+	return fmt.Sprintf("[%s]", s)
+}
+
+func (d *mssql) SqlType(f interface{}, size int) (string, error) {
+	switch t := columnValue(f).(type) {
+	case SqlTyper:
+		return t.SqlType(size), nil
+	case jsonColumn:
+		return "nvarchar(max)", nil
+	case Id:
+		return "bigint", nil
+	case UUID:
+		return "char(36)", nil
+	case time.Time, Created, Updated:
+		return "datetime2", nil
+	case bool:
+		return "bit", nil
+	case int, int8, int16, int32, uint, uint8, uint16, uint32:
+		return "int", nil
+	case int64, uint64:
+		return "bigint", nil
+	case float32, float64:
+		return "float", nil
+	case []byte:
+		if size > 0 && size <= 8000 {
+			return fmt.Sprintf("varbinary(%d)", size), nil
+		}
+		return "varbinary(max)", nil
+	case string:
+		if size > 0 && size <= 4000 {
+			return fmt.Sprintf("nvarchar(%d)", size), nil
+		}
+		return "nvarchar(max)", nil
+	}
+	return "", &UnsupportedTypeError{reflect.TypeOf(f)}
+}
+
+func (d *mssql) SetModelValue(driverValue, fieldValue reflect.Value) error {
+	// character columns are returned as string
+	if s, ok := driverValue.Interface().(string); ok {
+		var v interface{} = []byte(s)
+		driverValue = reflect.ValueOf(&v).Elem()
+	}
+	return d.base.SetModelValue(driverValue, fieldValue)
+}
+
+func (d *mssql) QuerySql(q *Query) (string, []interface{}) {
+	query, args := d.querySql(q)
+	// there is no LIMIT, OFFSET ... FETCH NEXT is part of the ORDER BY clause
+	if q.limit > 0 || q.offset > 0 {
+		if q.orderBy == "" {
+			query = append(query, "ORDER BY (SELECT NULL)")
+		}
+		query = append(query, "OFFSET ? ROWS")
+		args = append(args, q.offset)
+		if x := q.limit; x > 0 {
+			query = append(query, "FETCH NEXT ? ROWS ONLY")
+			args = append(args, q.limit)
+		}
+	}
+	return substituteMarkers(d.Dialect, strings.Join(query, " ")), args
+}
+
+func (d *mssql) Insert(hood *Hood, model *Model) (interface{}, error) {
+	if !model.AutoIncrement() {
+		return d.base.Insert(hood, model)
+	}
+	sql, args := d.Dialect.InsertSql(model)
+	var id int64
+	err := hood.QueryRow(sql, args...).Scan(&id)
+	return Id(id), err
+}
+
+func (d *mssql) InsertSql(model *Model) (string, []interface{}) {
+	m := 0
+	columns, markers, values := columnsMarkersAndValuesForModel(d.Dialect, model, &m, true)
+	quotedColumns := make([]string, 0, len(columns))
+	for _, c := range columns {
+		quotedColumns = append(quotedColumns, d.Dialect.Quote(c))
+	}
+	output := ""
+	if model.AutoIncrement() {
+		output = fmt.Sprintf(" OUTPUT INSERTED.%v", d.Dialect.Quote(model.Pk.Name))
+	}
+	sql := fmt.Sprintf(
+		"INSERT INTO %v (%v)%v VALUES (%v)",
+		d.Dialect.Quote(model.Table),
+		strings.Join(quotedColumns, ", "),
+		output,
+		strings.Join(markers, ", "),
+	)
+	return sql, values
+}
+
+func (d *mssql) InsertAll(hood *Hood, models []*Model) ([]interface{}, error) {
+	if !models[0].AutoIncrement() {
+		return d.base.InsertAll(hood, models)
+	}
+	// OUTPUT returns the rows in no particular order, so each id comes with
+	// the index of its row
+	sql, args := d.Dialect.InsertAllSql(models)
+	return queryInsertedIds(hood, sql, args, len(models))
+}
+
+// InsertAllSql returns a MERGE statement for auto-increment keys, the only
+// statement whose OUTPUT clause can refer to the source rows. Each row is
+// numbered to match it with its inserted id.
+func (d *mssql) InsertAllSql(models []*Model) (string, []interface{}) {
+	if !models[0].AutoIncrement() {
+		return d.base.InsertAllSql(models)
+	}
+	columns, rows, values := d.insertAllValues(models)
+	source, row := d.Dialect.Quote("source"), d.Dialect.Quote("row")
+	sourceColumns := make([]string, 0, len(columns))
+	for _, c := range columns {
+		sourceColumns = append(sourceColumns, source+"."+c)
+	}
+	for i := range rows {
+		// append the row number to the parenthesized markers
+		rows[i] = fmt.Sprintf("%v, %d)", strings.TrimSuffix(rows[i], ")"), i)
+	}
+	sql := fmt.Sprintf(
+		"MERGE INTO %v USING (VALUES %v) AS %v (%v, %v) ON 1 = 0 "+
+			"WHEN NOT MATCHED THEN INSERT (%v) VALUES (%v) "+
+			"OUTPUT %v.%v, INSERTED.%v;",
+		d.Dialect.Quote(models[0].Table),
+		strings.Join(rows, ", "),
+		source,
+		strings.Join(columns, ", "),
+		row,
+		strings.Join(columns, ", "),
+		strings.Join(sourceColumns, ", "),
+		source,
+		row,
+		d.Dialect.Quote(models[0].Pk.Name),
+	)
+	return sql, values
+}
+
+func (d *mssql) MaxInsertRows(columns int) int {
+	// at most 1000 rows per VALUES clause
+	n := maxInsertRows(d.Dialect.MaxParams(), columns)
+	if n > 1000 {
+		n = 1000
+	}
+	return n
+}
+
+func (d *mssql) MaxParams() int {
+	// at most 2100 parameters, two of which sp_executesql takes for the
+	// statement and its declarations
+	return 2098
+}
+
+func (d *mssql) CreateTableSql(model *Model, ifNotExists bool) (string, error) {
+	sql, err := d.base.CreateTableSql(model, false)
+	if err != nil {
+		return "", err
+	}
+	if ifNotExists {
+		return fmt.Sprintf("IF OBJECT_ID(%v, 'U') IS NULL %v", d.quoteString(model.Table), sql), nil
+	}
+	return sql, nil
+}
+
+func (d *mssql) RenameTableSql(from, to string) string {
+	return fmt.Sprintf("EXEC sp_rename %v, %v", d.quoteString(from), d.quoteString(to))
+}
+
+func (d *mssql) AddColumnSql(table, column string, typ interface{}, size int, fk *ForeignKey) (string, error) {
+	sqlType, err := d.Dialect.SqlType(typ, size)
+	if err != nil {
+		return "", err
+	}
+	sql := fmt.Sprintf(
+		"ALTER TABLE %v ADD %v %v",
+		d.Dialect.Quote(table),
+		d.Dialect.Quote(column),
+		sqlType,
+	)
+	if fk != nil {
+		sql += ", " + d.Dialect.ForeignKeySql(fk)
+	}
+	return sql, nil
+}
+
+func (d *mssql) RenameColumnSql(table, from, to string) string {
+	return fmt.Sprintf(
+		"EXEC sp_rename %v, %v, 'COLUMN'",
+		d.quoteString(table+"."+from),
+		d.quoteString(to),
+	)
+}
+
+func (d *mssql) ChangeColumnSql(table, column string, typ interface{}, size int) (string, error) {
+	sqlType, err := d.Dialect.SqlType(typ, size)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(
+		"ALTER TABLE %v ALTER COLUMN %v %v",
+		d.Dialect.Quote(table),
+		d.Dialect.Quote(column),
+		sqlType,
+	), nil
+}
+
+func (d *mssql) DropIndexSql(name string) string {
+	// indexes are scoped by table, so look up the table the index belongs to
+	return fmt.Sprintf(
+		"DECLARE @sql nvarchar(max) = (SELECT 'DROP INDEX %v ON ' + QUOTENAME(OBJECT_NAME(object_id)) FROM sys.indexes WHERE name = %v); EXEC(@sql)",
+		strings.Replace(d.Dialect.Quote(name), "'", "''", -1),
+		d.quoteString(name),
+	)
+}
+
+func (d *mssql) SavepointSql(name string) string {
+	return fmt.Sprintf("SAVE TRANSACTION %v", d.Dialect.Quote(name))
+}
+
+func (d *mssql) ReleaseSavepointSql(name string) string {
+	// savepoints are released with the transaction
+	return ""
+}
+
+func (d *mssql) RollbackToSavepointSql(name string) string {
+	return fmt.Sprintf("ROLLBACK TRANSACTION %v", d.Dialect.Quote(name))
+}
+
+func (d *mssql) IsRetryable(err error) bool {
+	// the driver errors expose their error number
+	var numErr interface {
+		SQLErrorNumber() int32
+	}
+	if errors.As(err, &numErr) {
+		return numErr.SQLErrorNumber() == 1205 // deadlock victim
+	}
+	return false
+}
+
+var (
+	mssqlConstraint = regexp.MustCompile(`(?:constraint|index) ['"]([^'"]*)['"]`)
+	mssqlObject     = regexp.MustCompile(`(?:object|table) ['"](?:[^'"]*\.)?([^'".]*)['"]`)
+	mssqlColumn     = regexp.MustCompile(`column '([^']*)'`)
+)
+
+func (d *mssql) ConvertError(err error) error {
+	if isConstraintViolation(err) {
+		return err
+	}
+	var msgErr interface {
+		SQLErrorNumber() int32
+		SQLErrorMessage() string
+	}
+	if !errors.As(err, &msgErr) {
+		return err
+	}
+	msg := msgErr.SQLErrorMessage()
+	v := ConstraintViolation{Err: err}
+	if m := mssqlConstraint.FindStringSubmatch(msg); m != nil {
+		v.Constraint = m[1]
+	}
+	if m := mssqlObject.FindStringSubmatch(msg); m != nil {
+		v.Table = m[1]
+	}
+	if m := mssqlColumn.FindStringSubmatch(msg); m != nil {
+		v.Column = m[1]
+	}
+	switch msgErr.SQLErrorNumber() {
+	case 2601, 2627: // duplicate key in unique index or constraint
+		return &UniqueViolationError{v}
+	case 547: // foreign key or check constraint conflict
+		if strings.Contains(msg, "CHECK constraint") {
+			return &CheckViolationError{v}
+		}
+		return &ForeignKeyViolationError{v}
+	case 515: // cannot insert NULL
+		return &NotNullViolationError{v}
+	}
+	return err
+}
+
+func (d *mssql) KeywordAutoIncrement() string {
+	return "IDENTITY(1,1)"
+}
+
+// quoteString quotes s as a string literal.
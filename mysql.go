@@ -1,8 +1,12 @@
 package hood
 
 import (
+	"errors"
 	"fmt"
+	mymysql "github.com/ziutek/mymysql/mysql"
 	"reflect"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -32,34 +36,115 @@ func (d *mysql) ParseBool(value reflect.Value) bool {
 	return value.Int() != 0
 }
 
-func (d *mysql) SqlType(f interface{}, size int) string {
-	switch f.(type) {
+func (d *mysql) SqlType(f interface{}, size int) (string, error) {
+	switch t := columnValue(f).(type) {
+	case SqlTyper:
+		return t.SqlType(size), nil
+	case jsonColumn:
+		return "json", nil
 	case Id:
-		return "bigint"
+		return "bigint", nil
+	case UUID:
+		return "char(36)", nil
 	case time.Time, Created, Updated:
-		return "timestamp"
+		return "timestamp", nil
 	case bool:
-		return "boolean"
+		return "boolean", nil
 	case int, int8, int16, int32, uint, uint8, uint16, uint32:
-		return "int"
+		return "int", nil
 	case int64, uint64:
-		return "bigint"
+		return "bigint", nil
 	case float32, float64:
-		return "double"
+		return "double", nil
 	case []byte:
 		if size > 0 && size < 65532 {
-			return fmt.Sprintf("varbinary(%d)", size)
+			return fmt.Sprintf("varbinary(%d)", size), nil
 		}
-		return "longblob"
+		return "longblob", nil
 	case string:
 		if size > 0 && size < 65532 {
-			return fmt.Sprintf("varchar(%d)", size)
+			return fmt.Sprintf("varchar(%d)", size), nil
 		}
-		return "longtext"
+		return "longtext", nil
 	}
-	panic("invalid sql type")
+	return "", &UnsupportedTypeError{reflect.TypeOf(f)}
+}
+
+func (d *mysql) IsRetryable(err error) bool {
+	var ptrErr *mymysql.Error
+	if errors.As(err, &ptrErr) {
+		return ptrErr.Code == 1213 // ER_LOCK_DEADLOCK
+	}
+	var valueErr mymysql.Error
+	if errors.As(err, &valueErr) {
+		return valueErr.Code == 1213
+	}
+	return false
+}
+
+var (
+	// mysqlError matches the errors returned by the mymysql driver
+	mysqlError = regexp.MustCompile(`(?s)^Received #(\d+) error from MySQL server: "(.*)"$`)
+
+	mysqlDuplicateKey = regexp.MustCompile(`for key '(?:([^'.]*)\.)?([^']*)'`)
+	mysqlForeignKey   = regexp.MustCompile("\\(`[^`]*`\\.`([^`]*)`, CONSTRAINT `([^`]*)` FOREIGN KEY \\(([^)]*)\\)")
+	mysqlColumn       = regexp.MustCompile(`^(?:Column|Field) '([^']*)'`)
+	mysqlCheck        = regexp.MustCompile(`^Check constraint '([^']*)'`)
+)
+
+func (d *mysql) ConvertError(err error) error {
+	// the driver is not imported, the error number is parsed from the message
+	if err == nil || isConstraintViolation(err) {
+		return err
+	}
+	m := mysqlError.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	return convertMysqlError(err, m[1], m[2])
+}
+
+// convertMysqlError converts the MySQL server error with the specified number
+// and message into a constraint violation error, if it is one.
+func convertMysqlError(err error, number, msg string) error {
+	v := ConstraintViolation{Err: err}
+	switch number {
+	case "1062": // ER_DUP_ENTRY
+		if m := mysqlDuplicateKey.FindStringSubmatch(msg); m != nil {
+			v.Table, v.Constraint = m[1], m[2]
+		}
+		return &UniqueViolationError{v}
+	case "1216", "1217", "1451", "1452": // ER_NO_REFERENCED_ROW, ER_ROW_IS_REFERENCED
+		if m := mysqlForeignKey.FindStringSubmatch(msg); m != nil {
+			v.Table, v.Constraint = m[1], m[2]
+			v.Column = strings.Replace(m[3], "`", "", -1)
+		}
+		return &ForeignKeyViolationError{v}
+	case "1048", "1364": // ER_BAD_NULL_ERROR, ER_NO_DEFAULT_FOR_FIELD
+		if m := mysqlColumn.FindStringSubmatch(msg); m != nil {
+			v.Column = m[1]
+		}
+		return &NotNullViolationError{v}
+	case "3819": // ER_CHECK_CONSTRAINT_VIOLATED
+		if m := mysqlCheck.FindStringSubmatch(msg); m != nil {
+			v.Constraint = m[1]
+		}
+		return &CheckViolationError{v}
+	}
+	return err
+}
+
+func (d *mysql) DropForeignKeySql(table, name string) string {
+	return fmt.Sprintf("ALTER TABLE %v DROP FOREIGN KEY %v", d.Dialect.Quote(table), d.Dialect.Quote(name))
 }
 
 func (d *mysql) KeywordAutoIncrement() string {
 	return "AUTO_INCREMENT"
 }
+
+// autoIncrementIntegerPk keeps AUTO_INCREMENT on integer fields tagged pk, so
+// existing schemas don't change. Zero keys are left to the database, explicit
+// key values are inserted.
+func (d *mysql) autoIncrementIntegerPk() bool {
+	return true
+}
@@ -1,8 +1,11 @@
 package hood
 
 import (
+	"errors"
 	"fmt"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"reflect"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -21,32 +24,41 @@ func NewPostgres() Dialect {
 	return d
 }
 
-func (d *postgres) SqlType(f interface{}, size int) string {
-	switch f.(type) {
+func (d *postgres) SqlType(f interface{}, size int) (string, error) {
+	switch t := columnValue(f).(type) {
+	case SqlTyper:
+		return t.SqlType(size), nil
+	case jsonColumn:
+		return "jsonb", nil
 	case Id:
-		return "bigserial"
+		return "bigserial", nil
+	case UUID:
+		return "uuid", nil
 	case time.Time, Created, Updated:
-		return "timestamp with time zone"
+		return "timestamp with time zone", nil
 	case bool:
-		return "boolean"
+		return "boolean", nil
 	case int, int8, int16, int32, uint, uint8, uint16, uint32:
-		return "integer"
+		return "integer", nil
 	case int64, uint64:
-		return "bigint"
+		return "bigint", nil
 	case float32, float64:
-		return "double precision"
+		return "double precision", nil
 	case []byte:
-		return "bytea"
+		return "bytea", nil
 	case string:
 		if size > 0 && size < 65532 {
-			return fmt.Sprintf("varchar(%d)", size)
+			return fmt.Sprintf("varchar(%d)", size), nil
 		}
-		return "text"
+		return "text", nil
 	}
-	panic("invalid sql type")
+	return "", &UnsupportedTypeError{reflect.TypeOf(f)}
 }
 
-func (d *postgres) Insert(hood *Hood, model *Model) (Id, error) {
+func (d *postgres) Insert(hood *Hood, model *Model) (interface{}, error) {
+	if !model.AutoIncrement() {
+		return d.base.Insert(hood, model)
+	}
 	sql, args := d.Dialect.InsertSql(model)
 	var id int64
 	err := hood.QueryRow(sql, args...).Scan(&id)
@@ -55,21 +67,112 @@ func (d *postgres) Insert(hood *Hood, model *Model) (Id, error) {
 
 func (d *postgres) InsertSql(model *Model) (string, []interface{}) {
 	m := 0
-	columns, markers, values := columnsMarkersAndValuesForModel(d.Dialect, model, &m)
+	columns, markers, values := columnsMarkersAndValuesForModel(d.Dialect, model, &m, true)
 	quotedColumns := make([]string, 0, len(columns))
 	for _, c := range columns {
 		quotedColumns = append(quotedColumns, d.Dialect.Quote(c))
 	}
 	sql := fmt.Sprintf(
-		"INSERT INTO %v (%v) VALUES (%v) RETURNING %v",
+		"INSERT INTO %v (%v) VALUES (%v)",
 		d.Dialect.Quote(model.Table),
 		strings.Join(quotedColumns, ", "),
 		strings.Join(markers, ", "),
-		d.Dialect.Quote(model.Pk.Name),
+	)
+	if model.AutoIncrement() {
+		sql += fmt.Sprintf(" RETURNING %v", d.Dialect.Quote(model.Pk.Name))
+	}
+	return sql, values
+}
+
+func (d *postgres) InsertAll(hood *Hood, models []*Model) ([]interface{}, error) {
+	if !models[0].AutoIncrement() {
+		return d.base.InsertAll(hood, models)
+	}
+	sql, args := d.Dialect.InsertAllSql(models)
+	return queryInsertedIds(hood, sql, args, len(models))
+}
+
+// InsertAllSql draws the auto-increment keys from the sequence of the key
+// column for each row number first, because RETURNING doesn't return the rows
+// in any particular order. The statement returns the row numbers and keys.
+func (d *postgres) InsertAllSql(models []*Model) (string, []interface{}) {
+	if !models[0].AutoIncrement() {
+		return d.base.InsertAllSql(models)
+	}
+	table, pk := d.Dialect.Quote(models[0].Table), d.Dialect.Quote(models[0].Pk.Name)
+	source, row := d.Dialect.Quote("source"), d.Dialect.Quote("row")
+	columns, rows, values := d.insertAllValues(models)
+	for i := range rows {
+		// prepend the key of the row to the parenthesized markers
+		rows[i] = fmt.Sprintf("((SELECT %v FROM %v WHERE %v = %d), %v", pk, source, row, i, strings.TrimPrefix(rows[i], "("))
+	}
+	sql := fmt.Sprintf(
+		"WITH %v AS (SELECT %v, nextval(pg_get_serial_sequence(%v, %v)) AS %v FROM generate_series(0, %d) AS %v), "+
+			"%v AS (INSERT INTO %v (%v) VALUES %v) "+
+			"SELECT %v, %v FROM %v",
+		source,
+		row,
+		d.quoteString(table),
+		d.quoteString(models[0].Pk.Name),
+		pk,
+		len(models)-1,
+		row,
+		d.Dialect.Quote("inserted"),
+		table,
+		strings.Join(append([]string{pk}, columns...), ", "),
+		strings.Join(rows, ", "),
+		row,
+		pk,
+		source,
 	)
 	return sql, values
 }
 
+func (d *postgres) IsRetryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "40001", "40P01": // serialization_failure, deadlock_detected
+			return true
+		}
+	}
+	return false
+}
+
+// pgKeyDetail matches the columns in the detail message of unique and foreign
+// key violations, e.g. 'Key (email)=(a@b.c) already exists.'
+var pgKeyDetail = regexp.MustCompile(`^Key \((.+?)\)=`)
+
+func (d *postgres) ConvertError(err error) error {
+	if isConstraintViolation(err) {
+		return err
+	}
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	v := ConstraintViolation{
+		Table:      pqErr.Table,
+		Column:     pqErr.Column,
+		Constraint: pqErr.Constraint,
+		Err:        err,
+	}
+	if m := pgKeyDetail.FindStringSubmatch(pqErr.Detail); v.Column == "" && m != nil {
+		v.Column = m[1]
+	}
+	switch pqErr.Code {
+	case "23505": // unique_violation
+		return &UniqueViolationError{v}
+	case "23503": // foreign_key_violation
+		return &ForeignKeyViolationError{v}
+	case "23502": // not_null_violation
+		return &NotNullViolationError{v}
+	case "23514": // check_violation
+		return &CheckViolationError{v}
+	}
+	return err
+}
+
 func (d *postgres) KeywordAutoIncrement() string {
 	// postgres has not auto increment keyword, uses SERIAL type
 	return ""
@@ -0,0 +1,455 @@
+package hood
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Query is an immutable query on a Hood. Every method that modifies the query
+// returns a modified copy, so a query can be shared, extended and run from
+// multiple goroutines, for example
+//
+//   active := hd.Where("active", "=", true)
+//   err := active.And("age", ">", 21).Find(&adults)
+//   err = active.OrderBy("name").Limit(10).Find(&first10)
+//
+type Query struct {
+	hood        *Hood
+	selectPaths []Path
+	selectTable string
+	aggregate   string // aggregate function expression replacing the select paths
+	where       []interface{}
+	limit       int
+	offset      int
+	orderBy     Path
+	order       string
+	joins       []*join
+	groupBy     Path
+	havingCond  string
+	havingArgs  []interface{}
+	preloads    []string // association fields loaded after Find
+	err         error    // the first error while building the query
+}
+
+// clone returns a copy of the query. Slices are capped, so appending to them
+// does not modify the original query.
+func (q *Query) clone() *Query {
+	c := *q
+	c.selectPaths = c.selectPaths[:len(c.selectPaths):len(c.selectPaths)]
+	c.where = c.where[:len(c.where):len(c.where)]
+	c.joins = c.joins[:len(c.joins):len(c.joins)]
+	c.havingArgs = c.havingArgs[:len(c.havingArgs):len(c.havingArgs)]
+	c.preloads = c.preloads[:len(c.preloads):len(c.preloads)]
+	return &c
+}
+
+// WithContext returns a copy of the query that runs with ctx, see
+// Hood.WithContext.
+func (q *Query) WithContext(ctx context.Context) *Query {
+	c := q.clone()
+	c.hood = q.hood.WithContext(ctx)
+	return c
+}
+
+func (q *Query) updateError(e error) {
+	// don't shadow the first error
+	if e != nil && q.err == nil {
+		q.err = e
+	}
+}
+
+// Select adds a SELECT clause to the query with the specified table and columns.
+// The table can either be a string or it's name can be inferred from the passed
+// interface{} type. Other values make the query fail with ErrInvalidTable.
+func (q *Query) Select(table interface{}, paths ...Path) *Query {
+	c := q.clone()
+	c.selectPaths = paths
+	tn, err := tableName(table)
+	c.updateError(err)
+	c.selectTable = tn
+	return c
+}
+
+// Where adds a WHERE clause to the query. You can concatenate using the
+// And and Or methods.
+//
+// Supported operators are =, !=, <>, <, <=, >, >=, LIKE and NOT LIKE, which
+// compare against a value or Path, IS NULL and IS NOT NULL, which ignore the
+// value, IN and NOT IN, which expect a slice, and BETWEEN and NOT BETWEEN,
+// which expect a slice of two values, for example
+//
+//   hd.Where("id", "IN", []int{1, 2, 3}).And("created", "BETWEEN", []time.Time{from, to})
+//
+// Invalid operators or values are reported by the method that runs the query.
+func (q *Query) Where(a Path, op string, b interface{}) *Query {
+	x, err := newClause(a, op, b)
+	return q.appendWhere((*whereClause)(x), err)
+}
+
+// And adds a AND clause to the WHERE query. You can concatenate using the
+// And and Or methods.
+func (q *Query) And(a Path, op string, b interface{}) *Query {
+	x, err := newClause(a, op, b)
+	return q.appendWhere((*andClause)(x), err)
+}
+
+// Or adds a OR clause to the WHERE query. You can concatenate using the
+// And and Or methods.
+func (q *Query) Or(a Path, op string, b interface{}) *Query {
+	x, err := newClause(a, op, b)
+	return q.appendWhere((*orClause)(x), err)
+}
+
+// WhereGroup adds a WHERE clause with the conditions added to c in
+// parentheses. You can concatenate using the And and Or methods, for example
+//
+//   hd.WhereGroup(func(c *hood.Cond) {
+//       c.Where("a", "=", 1).Or("b", "=", 2)
+//   }).And("c", "=", 3)
+//
+func (q *Query) WhereGroup(f func(c *Cond)) *Query {
+	where, err := newGroup(f)
+	return q.appendWhere(&whereGroup{where}, err)
+}
+
+// AndGroup adds an AND clause with the conditions added to c in parentheses
+// to the WHERE query.
+func (q *Query) AndGroup(f func(c *Cond)) *Query {
+	where, err := newGroup(f)
+	return q.appendWhere(&andGroup{where}, err)
+}
+
+// OrGroup adds an OR clause with the conditions added to c in parentheses
+// to the WHERE query.
+func (q *Query) OrGroup(f func(c *Cond)) *Query {
+	where, err := newGroup(f)
+	return q.appendWhere(&orGroup{where}, err)
+}
+
+func (q *Query) appendWhere(v interface{}, err error) *Query {
+	c := q.clone()
+	c.updateError(err)
+	c.where = append(c.where, v)
+	return c
+}
+
+// Limit adds a LIMIT clause to the query.
+func (q *Query) Limit(limit int) *Query {
+	c := q.clone()
+	c.limit = limit
+	return c
+}
+
+// Offset adds an OFFSET clause to the query.
+func (q *Query) Offset(offset int) *Query {
+	c := q.clone()
+	c.offset = offset
+	return c
+}
+
+// OrderBy adds an ORDER BY clause to the query.
+func (q *Query) OrderBy(path Path) *Query {
+	c := q.clone()
+	c.orderBy = path
+	return c
+}
+
+func (q *Query) Asc() *Query {
+	c := q.clone()
+	c.order = "ASC"
+	return c
+}
+
+func (q *Query) Desc() *Query {
+	c := q.clone()
+	c.order = "DESC"
+	return c
+}
+
+// Join performs a JOIN on tables, for example
+//   Join(hood.InnerJoin, &User{}, "user.id", "order.id")
+func (q *Query) Join(op Join, table interface{}, a Path, b Path) *Query {
+	c := q.clone()
+	tn, err := tableName(table)
+	c.updateError(err)
+	c.joins = append(c.joins, &join{
+		join:  op,
+		table: tn,
+		a:     a,
+		b:     b,
+	})
+	return c
+}
+
+// GroupBy adds a GROUP BY clause to the query.
+func (q *Query) GroupBy(path Path) *Query {
+	c := q.clone()
+	c.groupBy = path
+	return c
+}
+
+// Having adds a HAVING clause to the query.
+func (q *Query) Having(condition string, args ...interface{}) *Query {
+	c := q.clone()
+	c.havingCond = condition
+	c.havingArgs = append(c.havingArgs, args...)
+	return c
+}
+
+// Find performs a find using the query. If no explicit SELECT clause was
+// specified, the select is inferred from the passed interface type.
+func (q *Query) Find(out interface{}) error {
+	if q.err != nil {
+		return q.err
+	}
+	// infer the select statement from the type if not set
+	if q.selectTable == "" {
+		q = q.Select(out)
+	}
+	query, args := q.hood.Dialect.QuerySql(q)
+	err := q.hood.FindSql(out, query, args...)
+	if err != nil || len(q.preloads) == 0 {
+		return err
+	}
+	return q.preload(out, q.preloads)
+}
+
+// Preload loads the association declared by the struct field with the
+// specified name after Find, e.g. Preload("Posts") for a field declared as
+//
+//   Posts []Post `sql:"has_many(user_id)"`
+//
+// Each preloaded association is loaded with a single query for all rows found.
+func (q *Query) Preload(name string) *Query {
+	c := q.clone()
+	c.preloads = append(c.preloads, name)
+	return c
+}
+
+// First performs a find using the query, limited to one row, and writes the
+// result to out, which must be a pointer to a struct. If no explicit SELECT
+// clause was specified, the select is inferred from the passed interface type.
+// ErrNotFound is returned if no row matches.
+func (q *Query) First(out interface{}) error {
+	return q.Limit(1).Find(out)
+}
+
+// Pluck performs a find of the single column at path using the query and
+// writes the results to out, which must be a pointer to a slice, e.g.
+// *[]string. The table has to be specified with Select before.
+func (q *Query) Pluck(path Path, out interface{}) error {
+	if q.selectTable == "" {
+		return errors.New("no table selected")
+	}
+	c := q.clone()
+	c.selectPaths = []Path{path}
+	return c.Find(out)
+}
+
+// FindMaps performs a find using the query and returns every row as a map from
+// column name to value. Values are returned as passed by the driver. The table
+// has to be specified with Select before.
+func (q *Query) FindMaps() ([]map[string]interface{}, error) {
+	if q.selectTable == "" {
+		return nil, errors.New("no table selected")
+	}
+	var out []map[string]interface{}
+	err := q.Find(&out)
+	return out, err
+}
+
+// Count returns the number of rows in table matching the query.
+func (q *Query) Count(table interface{}) (int64, error) {
+	var n sql.NullInt64
+	err := q.queryAggregate(table, "COUNT", "*", &n)
+	return n.Int64, err
+}
+
+// Sum returns the sum of the column at path for the rows matching the query.
+func (q *Query) Sum(table interface{}, path Path) (float64, error) {
+	var f sql.NullFloat64
+	err := q.queryAggregate(table, "SUM", path, &f)
+	return f.Float64, err
+}
+
+// Avg returns the average of the column at path for the rows matching the
+// query.
+func (q *Query) Avg(table interface{}, path Path) (float64, error) {
+	var f sql.NullFloat64
+	err := q.queryAggregate(table, "AVG", path, &f)
+	return f.Float64, err
+}
+
+// Min writes the minimum of the column at path for the rows matching the query
+// to out, which must be a pointer. out is not modified if no rows match.
+func (q *Query) Min(table interface{}, path Path, out interface{}) error {
+	return q.queryAggregateValue(table, "MIN", path, out)
+}
+
+// Max writes the maximum of the column at path for the rows matching the query
+// to out, which must be a pointer. out is not modified if no rows match.
+func (q *Query) Max(table interface{}, path Path, out interface{}) error {
+	return q.queryAggregateValue(table, "MAX", path, out)
+}
+
+func (q *Query) queryAggregateValue(table interface{}, fn string, path Path, out interface{}) error {
+	outValue := reflect.ValueOf(out)
+	if outValue.Kind() != reflect.Ptr || outValue.IsNil() {
+		return errors.New("expected pointer to value")
+	}
+	var v interface{}
+	err := q.queryAggregate(table, fn, path, &v)
+	if err != nil {
+		return err
+	}
+	return setModelValue(q.hood.Dialect, reflect.ValueOf(&v).Elem(), outValue.Elem())
+}
+
+// queryAggregate runs the aggregate function fn on path, using the where, join
+// and group by state of the query, and scans the result into dest. If a GROUP
+// BY clause is set, the result of the first group is returned.
+func (q *Query) queryAggregate(table interface{}, fn string, path Path, dest interface{}) error {
+	// the query error, or the error of an invalid table
+	if err := q.Select(table).err; err != nil {
+		return err
+	}
+	query, args := q.aggregateSql(table, fn, path)
+	err := q.hood.QueryRow(query, args...).Scan(dest)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return q.hood.updateTxError(err)
+}
+
+func (q *Query) aggregateSql(table interface{}, fn string, path Path) (string, []interface{}) {
+	c := q.Select(table)
+	// the aggregate covers all matching rows, not a page of them
+	c.orderBy, c.order, c.limit, c.offset = "", "", 0, 0
+	expr := "*"
+	if path != "*" {
+		expr = path.Quote(q.hood.Dialect)
+	}
+	c.aggregate = fmt.Sprintf("%s(%s)", fn, expr)
+	return q.hood.Dialect.QuerySql(c)
+}
+
+// Iterate performs a find using the query, like Find, but instead of loading
+// all rows at once it returns an Iterator streaming them. If no explicit
+// SELECT clause was specified, the select is inferred from the passed
+// interface type. The Iterator has to be closed after use.
+func (q *Query) Iterate(table interface{}) (*Iterator, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	if q.selectTable == "" {
+		q = q.Select(table)
+	}
+	query, args := q.hood.Dialect.QuerySql(q)
+	return q.hood.IterateSql(query, args...)
+}
+
+// FindInBatches performs a find using the query, loading batchSize rows at a
+// time into out, which must be a pointer to a struct slice, and calls f after
+// each batch. Rows are paged by primary key, so any order, limit or offset of
+// the query is ignored. Iteration stops on the first error returned by f.
+func (q *Query) FindInBatches(out interface{}, batchSize int, f func() error) error {
+	if q.err != nil {
+		return q.err
+	}
+	if batchSize <= 0 {
+		return errors.New("batch size must be greater than zero")
+	}
+	sliceValue := reflect.ValueOf(out)
+	if sliceValue.Kind() != reflect.Ptr || sliceValue.Elem().Kind() != reflect.Slice ||
+		!isRowStruct(sliceValue.Elem().Type().Elem()) {
+		return errors.New("expected pointer to struct slice *[]struct")
+	}
+	sliceValue = sliceValue.Elem()
+	model, err := interfaceToModel(reflect.New(sliceValue.Type().Elem()).Interface())
+	if err != nil {
+		return err
+	}
+	if model.Pk == nil {
+		return errors.New("model has no primary key")
+	}
+	if model.CompositePk() {
+		return errors.New("composite primary keys are not supported")
+	}
+	if q.selectTable == "" {
+		q = q.Select(out)
+	}
+	pk := Path(q.selectTable + "." + model.Pk.Name)
+	q = q.OrderBy(pk).Asc().Limit(batchSize).Offset(0)
+	if !q.selectsColumn(model.Pk.Name) {
+		// the key of the last row is needed to load the next batch
+		q.selectPaths = append(q.selectPaths, pk)
+	}
+
+	batch := q
+	for {
+		query, args := q.hood.Dialect.QuerySql(batch)
+		sliceValue.Set(reflect.MakeSlice(sliceValue.Type(), 0, batchSize))
+		err := q.hood.FindSql(out, query, args...)
+		if err != nil {
+			return err
+		}
+		n := sliceValue.Len()
+		if n == 0 {
+			return nil
+		}
+		last, err := interfaceToModel(sliceValue.Index(n - 1).Addr().Interface())
+		if err != nil {
+			return err
+		}
+		err = f()
+		if err != nil {
+			return err
+		}
+		if n < batchSize {
+			return nil
+		}
+		after := &clause{a: pk, op: ">", b: last.Pk.Value}
+		batch = q.clone()
+		if len(q.where) == 0 {
+			batch.where = []interface{}{(*whereClause)(after)}
+		} else {
+			batch.where = []interface{}{&whereGroup{q.where}, (*andClause)(after)}
+		}
+	}
+}
+
+// selectsColumn tests if the selected paths of the query include the column
+// with the specified name of the selected table.
+func (q *Query) selectsColumn(name string) bool {
+	if len(q.selectPaths) == 0 {
+		return true
+	}
+	for _, path := range q.selectPaths {
+		switch string(path) {
+		case "*", name, q.selectTable + ".*", q.selectTable + "." + name:
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteFrom deletes the rows matched by the Where clause of the query. table
+// can either be a table struct or a string.
+//
+// Example:
+//
+//    hd.Where("amount", "=", 0).DeleteFrom("stock")
+//
+func (q *Query) DeleteFrom(table interface{}) error {
+	if q.err != nil {
+		return q.err
+	}
+	tn, err := tableName(table)
+	if err != nil {
+		return err
+	}
+	return q.hood.Dialect.DeleteFrom(q, tn)
+}
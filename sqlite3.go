@@ -0,0 +1,670 @@
+package hood
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterDialect("sqlite3", NewSqlite3())
+}
+
+type sqlite3 struct {
+	base
+}
+
+// sqlite3Column is a column definition as reported by PRAGMA table_info, used
+// to rebuild tables.
+type sqlite3Column struct {
+	name    string
+	source  string // column name in the original table
+	typ     string
+	notNull bool
+	dflt    sql.NullString
+	pk      int // position in the primary key, 0 if not part of it
+}
+
+// sqlite3TimeFormats are the layouts SQLite timestamps are stored in, which
+// are the formats produced by the sqlite3 driver and the built in date
+// functions.
+var sqlite3TimeFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func NewSqlite3() Dialect {
+	d := &sqlite3{}
+	d.base.Dialect = d
+	return d
+}
+
+func (d *sqlite3) NextMarker(pos *int) string {
+	return "?"
+}
+
+func (d *sqlite3) ParseBool(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Bool:
+		return value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() != 0
+	}
+	return false
+}
+
+func (d *sqlite3) SqlType(f interface{}, size int) (string, error) {
+	switch t := columnValue(f).(type) {
+	case SqlTyper:
+		return t.SqlType(size), nil
+	case jsonColumn:
+		return "text", nil
+	case Id:
+		return "integer", nil
+	case UUID:
+		return "char(36)", nil
+	case time.Time, Created, Updated:
+		return "datetime", nil
+	case bool:
+		return "boolean", nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "integer", nil
+	case float32, float64:
+		return "real", nil
+	case []byte:
+		return "blob", nil
+	case string:
+		if size > 0 && size < 65532 {
+			return fmt.Sprintf("varchar(%d)", size), nil
+		}
+		return "text", nil
+	}
+	return "", &UnsupportedTypeError{reflect.TypeOf(f)}
+}
+
+func (d *sqlite3) SetModelValue(driverValue, fieldValue reflect.Value) error {
+	// ignore zero types
+	if !driverValue.Elem().IsValid() {
+		return nil
+	}
+	v := driverValue.Elem().Interface()
+	switch fieldValue.Type() {
+	case reflect.TypeOf(time.Time{}), reflect.TypeOf(Created{}), reflect.TypeOf(Updated{}):
+		// timestamps are stored as text or unix time, depending on how the
+		// row was written
+		t, err := d.parseTime(v)
+		if err != nil {
+			return err
+		}
+		v = t
+	}
+	if s, ok := v.(string); ok {
+		v = []byte(s)
+	}
+	return d.base.SetModelValue(reflect.ValueOf(&v).Elem(), fieldValue)
+}
+
+func (d *sqlite3) parseTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case int64:
+		return time.Unix(t, 0), nil
+	case []byte:
+		return d.parseTime(string(t))
+	case string:
+		s := strings.TrimSuffix(t, "Z")
+		for _, layout := range sqlite3TimeFormats {
+			if x, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+				return x, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot parse time value '%s'", t)
+	}
+	return time.Time{}, fmt.Errorf("cannot set time value %T", v)
+}
+
+func (d *sqlite3) InsertAll(hood *Hood, models []*Model) ([]interface{}, error) {
+	if !models[0].AutoIncrement() {
+		return d.base.InsertAll(hood, models)
+	}
+	// only AUTOINCREMENT keys are assigned consecutively, a plain rowid alias
+	// may reuse the ids of deleted rows
+	autoIncrement, err := d.autoIncrementTable(hood, models[0].Table)
+	if err != nil {
+		return nil, err
+	}
+	if !autoIncrement {
+		return insertEach(hood, d.Dialect, models)
+	}
+	sql, args := d.Dialect.InsertAllSql(models)
+	result, err := hood.Exec(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	// unlike MySQL, the last insert id is the id of the last inserted row
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return insertedIds(models, id-int64(len(models))+1), nil
+}
+
+func (d *sqlite3) MaxParams() int {
+	// SQLITE_MAX_VARIABLE_NUMBER defaults to 999 before sqlite 3.32
+	return 999
+}
+
+func (d *sqlite3) RenameColumn(hood *Hood, table, from, to string) error {
+	// RENAME COLUMN is supported since 3.25.0
+	native, err := d.versionAtLeast(hood, 3, 25)
+	if err != nil {
+		return err
+	}
+	if native {
+		return d.base.RenameColumn(hood, table, from, to)
+	}
+	return d.rebuildTable(hood, table, func(columns []*sqlite3Column) []*sqlite3Column {
+		for _, c := range columns {
+			if c.name == from {
+				c.name = to
+			}
+		}
+		return columns
+	}, nil)
+}
+
+func (d *sqlite3) ChangeColumn(hood *Hood, table, column string, typ interface{}, size int) error {
+	// SQLite cannot change column types, the table has to be rebuilt
+	sqlType, err := d.SqlType(typ, size)
+	if err != nil {
+		return err
+	}
+	return d.rebuildTable(hood, table, func(columns []*sqlite3Column) []*sqlite3Column {
+		for _, c := range columns {
+			if c.name == column {
+				c.typ = sqlType
+			}
+		}
+		return columns
+	}, nil)
+}
+
+func (d *sqlite3) ChangeColumnSql(table, column string, typ interface{}, size int) (string, error) {
+	return "", errors.New("sqlite3 cannot change column types with a single statement, ChangeColumn rebuilds the table")
+}
+
+func (d *sqlite3) DropColumn(hood *Hood, table, column string) error {
+	// DROP COLUMN is supported since 3.35.0
+	native, err := d.versionAtLeast(hood, 3, 35)
+	if err != nil {
+		return err
+	}
+	if native {
+		return d.base.DropColumn(hood, table, column)
+	}
+	return d.rebuildTable(hood, table, func(columns []*sqlite3Column) []*sqlite3Column {
+		kept := []*sqlite3Column{}
+		for _, c := range columns {
+			if c.name != column {
+				kept = append(kept, c)
+			}
+		}
+		return kept
+	}, nil)
+}
+
+func (d *sqlite3) AddColumnSql(table, column string, typ interface{}, size int, fk *ForeignKey) (string, error) {
+	sql, err := d.base.AddColumnSql(table, column, typ, size, nil)
+	if err != nil || fk == nil {
+		return sql, err
+	}
+	// constraints can only be added as part of the column definition
+	return fmt.Sprintf("%v CONSTRAINT %v %v", sql, d.Quote(fk.Name), d.referencesSql(fk)), nil
+}
+
+func (d *sqlite3) AddForeignKey(hood *Hood, table string, fk *ForeignKey) error {
+	// SQLite cannot add constraints to existing tables
+	return d.rebuildTable(hood, table, nil, func(fks []*ForeignKey) []*ForeignKey {
+		return append(fks, fk)
+	})
+}
+
+func (d *sqlite3) DropForeignKey(hood *Hood, table, name string) error {
+	// SQLite cannot drop constraints, rebuilt tables name their foreign keys
+	// '<table>_<column>_fkey'
+	return d.rebuildTable(hood, table, nil, func(fks []*ForeignKey) []*ForeignKey {
+		kept := []*ForeignKey{}
+		for _, fk := range fks {
+			if fk.Name != name {
+				kept = append(kept, fk)
+			}
+		}
+		return kept
+	})
+}
+
+func (d *sqlite3) ConvertError(err error) error {
+	// the driver is not imported, the errors are identified by their message
+	if err == nil || isConstraintViolation(err) {
+		return err
+	}
+	msg := err.Error()
+	v := ConstraintViolation{Err: err}
+	switch {
+	case strings.HasPrefix(msg, "UNIQUE constraint failed: "):
+		v.Table, v.Column = sqlite3Columns(strings.TrimPrefix(msg, "UNIQUE constraint failed: "))
+		return &UniqueViolationError{v}
+	case strings.HasPrefix(msg, "FOREIGN KEY constraint failed"):
+		return &ForeignKeyViolationError{v}
+	case strings.HasPrefix(msg, "NOT NULL constraint failed: "):
+		v.Table, v.Column = sqlite3Columns(strings.TrimPrefix(msg, "NOT NULL constraint failed: "))
+		return &NotNullViolationError{v}
+	case strings.HasPrefix(msg, "CHECK constraint failed: "):
+		v.Constraint = strings.TrimPrefix(msg, "CHECK constraint failed: ")
+		return &CheckViolationError{v}
+	}
+	return err
+}
+
+// sqlite3Columns splits a list of columns like 'users.first, users.last' into
+// the table and the column names.
+func sqlite3Columns(s string) (string, string) {
+	table := ""
+	columns := []string{}
+	for _, c := range strings.Split(s, ", ") {
+		if i := strings.Index(c, "."); i >= 0 {
+			table, c = c[:i], c[i+1:]
+		}
+		columns = append(columns, c)
+	}
+	return table, strings.Join(columns, ", ")
+}
+
+func (d *sqlite3) versionAtLeast(hood *Hood, major, minor int) (bool, error) {
+	var version string
+	err := hood.QueryRow("SELECT sqlite_version()").Scan(&version)
+	if err != nil {
+		return false, err
+	}
+	c := strings.Split(version, ".")
+	if len(c) < 2 {
+		return false, fmt.Errorf("invalid sqlite version '%s'", version)
+	}
+	x, err := strconv.Atoi(c[0])
+	if err != nil {
+		return false, err
+	}
+	y, err := strconv.Atoi(c[1])
+	if err != nil {
+		return false, err
+	}
+	return x > major || (x == major && y >= minor), nil
+}
+
+// rebuildTable recreates table with the column definitions returned by alter
+// and the foreign keys returned by alterForeignKeys, and copies over all rows
+// and indexes. Either function may be nil. This is the procedure recommended
+// by the SQLite docs for schema changes ALTER TABLE does not support.
+//
+// Dropping the old table deletes the rows referencing it if foreign keys are
+// enabled, so they are disabled during the rebuild. This isn't possible inside
+// a transaction, so the rebuild fails if the table is referenced there.
+func (d *sqlite3) rebuildTable(hood *Hood, table string, alter func([]*sqlite3Column) []*sqlite3Column, alterForeignKeys func([]*ForeignKey) []*ForeignKey) error {
+	var foreignKeys bool
+	err := hood.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys)
+	if err != nil {
+		return err
+	}
+	if hood.IsTransaction() {
+		if foreignKeys {
+			referencing, err := d.referencingTables(hood, table)
+			if err != nil {
+				return err
+			}
+			if len(referencing) > 0 {
+				return fmt.Errorf("cannot rebuild table %v referenced by %v with foreign keys enabled inside a transaction, disable them before the transaction begins", table, strings.Join(referencing, ", "))
+			}
+		}
+		err = d.copyTable(hood, table, alter, alterForeignKeys)
+		if err != nil {
+			return err
+		}
+		return d.foreignKeyCheck(hood)
+	}
+
+	// the foreign_keys setting is per connection, so the rebuild runs on one
+	conn, err := hood.Db.Conn(hood.context())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c := hood.Copy()
+	c.qo = conn
+	c.txError = &txError{}
+	if foreignKeys {
+		err = c.execTx("PRAGMA foreign_keys = OFF")
+		if err != nil {
+			return err
+		}
+		defer c.execTx("PRAGMA foreign_keys = ON")
+	}
+	err = c.execTx("BEGIN")
+	if err != nil {
+		return err
+	}
+	err = d.copyTable(c, table, alter, alterForeignKeys)
+	if err == nil {
+		err = d.foreignKeyCheck(c)
+	}
+	if err != nil {
+		c.execTx("ROLLBACK")
+		return err
+	}
+	return c.execTx("COMMIT")
+}
+
+// referencingTables returns the tables with foreign keys referencing table.
+func (d *sqlite3) referencingTables(hood *Hood, table string) ([]string, error) {
+	var tables []string
+	err := hood.FindSql(&tables, "SELECT name FROM sqlite_master WHERE type = 'table'")
+	if err != nil {
+		return nil, err
+	}
+	referencing := []string{}
+	for _, name := range tables {
+		fks, err := d.foreignKeyTables(hood, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range fks {
+			if strings.EqualFold(ref, table) {
+				referencing = append(referencing, name)
+				break
+			}
+		}
+	}
+	return referencing, nil
+}
+
+// foreignKeyTables returns the tables referenced by the foreign keys of table.
+func (d *sqlite3) foreignKeyTables(hood *Hood, table string) ([]string, error) {
+	rows, err := hood.Query(fmt.Sprintf("PRAGMA foreign_key_list(%v)", d.Quote(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tables := []string{}
+	for rows.Next() {
+		var (
+			id, seq                   int
+			ref, from                 string
+			to                        sql.NullString
+			onUpdate, onDelete, match string
+		)
+		err = rows.Scan(&id, &seq, &ref, &from, &to, &onUpdate, &onDelete, &match)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, ref)
+	}
+	return tables, rows.Err()
+}
+
+// foreignKeyCheck returns an error if any row violates a foreign key.
+func (d *sqlite3) foreignKeyCheck(hood *Hood) error {
+	rows, err := hood.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var (
+			table, parent string
+			rowid         sql.NullInt64
+			fkid          int
+		)
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return err
+		}
+		return fmt.Errorf("foreign key violation in table %v referencing %v", table, parent)
+	}
+	return rows.Err()
+}
+
+// autoIncrementTable tests if the primary key of table is declared with
+// AUTOINCREMENT.
+func (d *sqlite3) autoIncrementTable(hood *Hood, table string) (bool, error) {
+	var tableSql string
+	err := hood.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&tableSql)
+	if err != nil {
+		return false, err
+	}
+	return strings.Contains(strings.ToUpper(tableSql), "AUTOINCREMENT"), nil
+}
+
+// copyTable performs the rebuild of rebuildTable, inside a transaction.
+func (d *sqlite3) copyTable(hood *Hood, table string, alter func([]*sqlite3Column) []*sqlite3Column, alterForeignKeys func([]*ForeignKey) []*ForeignKey) error {
+	autoIncrement, err := d.autoIncrementTable(hood, table)
+	if err != nil {
+		return err
+	}
+	columns, err := d.tableColumns(hood, table)
+	if err != nil {
+		return err
+	}
+	indexes, err := d.tableIndexes(hood, table)
+	if err != nil {
+		return err
+	}
+	fks, err := d.tableForeignKeys(hood, table)
+	if err != nil {
+		return err
+	}
+	if alter != nil {
+		columns = alter(columns)
+	}
+	if alterForeignKeys != nil {
+		fks = alterForeignKeys(fks)
+	}
+
+	// map renamed and dropped columns
+	names := map[string]string{}
+	defs := make([]string, 0, len(columns))
+	to := make([]string, 0, len(columns))
+	from := make([]string, 0, len(columns))
+	pks := []*sqlite3Column{}
+	for _, c := range columns {
+		if c.pk > 0 {
+			pks = append(pks, c)
+		}
+	}
+	sort.Slice(pks, func(i, j int) bool { return pks[i].pk < pks[j].pk })
+	for _, c := range columns {
+		names[c.source] = c.name
+		b := []string{d.Quote(c.name), c.typ}
+		if c.notNull {
+			b = append(b, d.KeywordNotNull())
+		}
+		if c.dflt.Valid {
+			b = append(b, d.KeywordDefault(c.dflt.String))
+		}
+		if c.pk > 0 && len(pks) == 1 {
+			b = append(b, d.KeywordPrimaryKey())
+			if autoIncrement {
+				b = append(b, d.KeywordAutoIncrement())
+			}
+		}
+		defs = append(defs, strings.Join(b, " "))
+		to = append(to, d.Quote(c.name))
+		from = append(from, d.Quote(c.source))
+	}
+	if len(pks) > 1 {
+		quoted := make([]string, 0, len(pks))
+		for _, c := range pks {
+			quoted = append(quoted, d.Quote(c.name))
+		}
+		defs = append(defs, fmt.Sprintf("%v (%v)", d.KeywordPrimaryKey(), strings.Join(quoted, ", ")))
+	}
+	for _, fk := range fks {
+		name, ok := names[fk.Column]
+		if !ok {
+			// column was dropped, so is the foreign key
+			continue
+		}
+		x := *fk
+		x.Name, x.Column = foreignKeyName(table, name), name
+		defs = append(defs, d.ForeignKeySql(&x))
+	}
+	tmp := "hood_rebuild_" + table
+	stmts := []string{
+		fmt.Sprintf("CREATE TABLE %v ( %v )", d.Quote(tmp), strings.Join(defs, ", ")),
+		fmt.Sprintf(
+			"INSERT INTO %v (%v) SELECT %v FROM %v",
+			d.Quote(tmp),
+			strings.Join(to, ", "),
+			strings.Join(from, ", "),
+			d.Quote(table),
+		),
+		d.DropTableSql(table, false),
+		d.RenameTableSql(tmp, table),
+	}
+L:
+	for _, index := range indexes {
+		cols := make([]string, 0, len(index.Columns))
+		for _, c := range index.Columns {
+			name, ok := names[c]
+			if !ok {
+				// column was dropped, so is the index
+				continue L
+			}
+			cols = append(cols, name)
+		}
+		stmts = append(stmts, d.CreateIndexSql(index.Name, table, index.Unique, cols...))
+	}
+	for _, s := range stmts {
+		if _, err := hood.Exec(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *sqlite3) tableColumns(hood *Hood, table string) ([]*sqlite3Column, error) {
+	rows, err := hood.Query(fmt.Sprintf("PRAGMA table_info(%v)", d.Quote(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := []*sqlite3Column{}
+	for rows.Next() {
+		var (
+			cid     int
+			notNull int
+			c       sqlite3Column
+		)
+		err = rows.Scan(&cid, &c.name, &c.typ, &notNull, &c.dflt, &c.pk)
+		if err != nil {
+			return nil, err
+		}
+		c.source = c.name
+		c.notNull = notNull != 0
+		columns = append(columns, &c)
+	}
+	return columns, rows.Err()
+}
+
+// tableForeignKeys returns the foreign keys of table, named
+// '<table>_<column>_fkey'. Foreign keys on multiple columns are not supported.
+func (d *sqlite3) tableForeignKeys(hood *Hood, table string) ([]*ForeignKey, error) {
+	rows, err := hood.Query(fmt.Sprintf("PRAGMA foreign_key_list(%v)", d.Quote(table)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	fks := []*ForeignKey{}
+	for rows.Next() {
+		var (
+			id, seq            int
+			to                 sql.NullString
+			onUpdate, onDelete string
+			match              string
+			fk                 ForeignKey
+		)
+		err = rows.Scan(&id, &seq, &fk.RefTable, &fk.Column, &to, &onUpdate, &onDelete, &match)
+		if err != nil {
+			return nil, err
+		}
+		if seq > 0 {
+			return nil, fmt.Errorf("cannot rebuild table %v with a foreign key on multiple columns", table)
+		}
+		fk.Name = foreignKeyName(table, fk.Column)
+		fk.RefColumn = to.String
+		fk.OnUpdate = sqlite3Action(onUpdate)
+		fk.OnDelete = sqlite3Action(onDelete)
+		fks = append(fks, &fk)
+	}
+	return fks, rows.Err()
+}
+
+// sqlite3Action converts a foreign key action as reported by PRAGMA
+// foreign_key_list to the form used in sql tags, e.g. 'cascade'.
+func sqlite3Action(s string) string {
+	if s == "NO ACTION" {
+		return ""
+	}
+	return strings.ToLower(s)
+}
+
+func (d *sqlite3) tableIndexes(hood *Hood, table string) (Indexes, error) {
+	rows, err := hood.Query("SELECT name, sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table)
+	if err != nil {
+		return nil, err
+	}
+	indexes := Indexes{}
+	for rows.Next() {
+		var name, indexSql string
+		if err = rows.Scan(&name, &indexSql); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		unique := strings.HasPrefix(strings.ToUpper(indexSql), "CREATE UNIQUE")
+		indexes = append(indexes, &Index{Name: name, Unique: unique})
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		rows, err := hood.Query(fmt.Sprintf("PRAGMA index_info(%v)", d.Quote(index.Name)))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var seqno, cid int
+			var name string
+			if err = rows.Scan(&seqno, &cid, &name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			index.Columns = append(index.Columns, name)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return indexes, nil
+}
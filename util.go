@@ -2,8 +2,10 @@ package hood
 
 import (
 	"bytes"
+	"database/sql"
 	"reflect"
 	"strings"
+	"time"
 )
 
 func toSnake(s string) string {
@@ -44,15 +46,99 @@ func snakeToUpperCamel(s string) string {
 	return buf.String()
 }
 
-func columnsMarkersAndValuesForModel(dialect Dialect, model *Model, markerPos *int) ([]string, []string, []interface{}) {
+// builtinTypes maps the kinds of named types to the builtin types SqlType
+// handles, see columnValue.
+var builtinTypes = map[reflect.Kind]reflect.Type{
+	reflect.Bool:    reflect.TypeOf(false),
+	reflect.Int:     reflect.TypeOf(int(0)),
+	reflect.Int8:    reflect.TypeOf(int8(0)),
+	reflect.Int16:   reflect.TypeOf(int16(0)),
+	reflect.Int32:   reflect.TypeOf(int32(0)),
+	reflect.Int64:   reflect.TypeOf(int64(0)),
+	reflect.Uint:    reflect.TypeOf(uint(0)),
+	reflect.Uint8:   reflect.TypeOf(uint8(0)),
+	reflect.Uint16:  reflect.TypeOf(uint16(0)),
+	reflect.Uint32:  reflect.TypeOf(uint32(0)),
+	reflect.Uint64:  reflect.TypeOf(uint64(0)),
+	reflect.Float32: reflect.TypeOf(float32(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+	reflect.String:  reflect.TypeOf(""),
+}
+
+// nullTypes maps the sql.Null* types to the types of the values they wrap.
+var nullTypes = map[reflect.Type]reflect.Type{
+	reflect.TypeOf(sql.NullBool{}):    reflect.TypeOf(false),
+	reflect.TypeOf(sql.NullByte{}):    reflect.TypeOf(uint8(0)),
+	reflect.TypeOf(sql.NullInt16{}):   reflect.TypeOf(int16(0)),
+	reflect.TypeOf(sql.NullInt32{}):   reflect.TypeOf(int32(0)),
+	reflect.TypeOf(sql.NullInt64{}):   reflect.TypeOf(int64(0)),
+	reflect.TypeOf(sql.NullFloat64{}): reflect.TypeOf(float64(0)),
+	reflect.TypeOf(sql.NullString{}):  reflect.TypeOf(""),
+	reflect.TypeOf(sql.NullTime{}):    reflect.TypeOf(time.Time{}),
+}
+
+// columnValue returns the value the column type of f is derived from.
+// Nullable fields, i.e. pointers and sql.Null* types, have the column type of
+// the value they point to or wrap. Named types of builtin kinds, e.g.
+// 'type Email string', are converted to the builtin type, except for Id, which
+// has its own column type.
+func columnValue(f interface{}) interface{} {
+	v := reflect.ValueOf(f)
+	if !v.IsValid() {
+		return f
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v = reflect.Zero(v.Type().Elem())
+		} else {
+			v = v.Elem()
+		}
+	}
+	t := v.Type()
+	if x, ok := nullTypes[t]; ok {
+		return reflect.Zero(x).Interface()
+	}
+	f = v.Interface()
+	if _, ok := f.(SqlTyper); ok {
+		return f
+	}
+	if _, ok := f.(Id); ok || t.PkgPath() == "" {
+		return f
+	}
+	if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+		return v.Bytes()
+	}
+	if b, ok := builtinTypes[t.Kind()]; ok {
+		return v.Convert(b).Interface()
+	}
+	return f
+}
+
+// columnArg returns the argument written to the column of a field with value
+// f. Pointer fields are written as the value they point to, or NULL.
+func columnArg(f interface{}) interface{} {
+	v := reflect.ValueOf(f)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		return v.Elem().Interface()
+	}
+	return f
+}
+
+// columnsMarkersAndValuesForModel returns the columns, markers and values
+// written for model. Primary keys are only included if withPk is set, e.g. on
+// insert, and if the database does not generate them.
+func columnsMarkersAndValuesForModel(dialect Dialect, model *Model, markerPos *int, withPk bool) ([]string, []string, []interface{}) {
 	columns := make([]string, 0, len(model.Fields))
 	markers := make([]string, 0, len(columns))
 	values := make([]interface{}, 0, len(columns))
 	for _, column := range model.Fields {
-		if !column.PrimaryKey() {
+		if !column.PrimaryKey() || (withPk && !generatedColumn(dialect, model, column)) {
 			columns = append(columns, column.Name)
 			markers = append(markers, dialect.NextMarker(markerPos))
-			values = append(values, column.Value)
+			values = append(values, columnArg(column.sqlValue()))
 		}
 	}
 	return columns, markers, values
@@ -0,0 +1,78 @@
+package hood
+
+import (
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+)
+
+// NewUUID returns a new random (version 4) UUID.
+func NewUUID() (UUID, error) {
+	var u UUID
+	_, err := rand.Read(u[:])
+	if err != nil {
+		return u, err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return u, nil
+}
+
+// ParseUUID parses the canonical 36 character form of a UUID, e.g.
+// "6ba7b810-9dad-11d1-80b4-00c04fd430c8".
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, fmt.Errorf("invalid uuid %q", s)
+	}
+	b := []byte(s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:])
+	if _, err := hex.Decode(u[:], b); err != nil {
+		return u, fmt.Errorf("invalid uuid %q", s)
+	}
+	return u, nil
+}
+
+// String returns the canonical 36 character form of u.
+func (u UUID) String() string {
+	b := make([]byte, 36)
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b)
+}
+
+// Value implements driver.Valuer, UUIDs are written in their canonical form.
+func (u UUID) Value() (driver.Value, error) {
+	return u.String(), nil
+}
+
+// Scan implements sql.Scanner. It accepts the canonical form as string or
+// []byte, or the 16 raw bytes. NULL scans as the zero UUID.
+func (u *UUID) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*u = UUID{}
+		return nil
+	case string:
+		x, err := ParseUUID(v)
+		if err != nil {
+			return err
+		}
+		*u = x
+		return nil
+	case []byte:
+		if len(v) == len(u) {
+			copy(u[:], v)
+			return nil
+		}
+		return u.Scan(string(v))
+	}
+	return fmt.Errorf("cannot scan %T into uuid", src)
+}